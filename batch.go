@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+// message delimiters for pipe mode
+const (
+	delimLine   = "line"
+	delimNull   = "null"
+	delimLength = "length"
+)
+
+// defaultWait is the time to wait for the replies after the end of input when no exit condition is set
+const defaultWait = time.Second
+
+// maxMessageSize limits the size of message read from stdin in pipe mode
+const maxMessageSize = 64 << 20
+
+// framer writes the messages into w separated according to the delimiter
+type framer struct {
+	w     io.Writer
+	delim string
+}
+
+func (f *framer) write(msg []byte) error {
+	var frame []byte
+	switch f.delim {
+	case delimLength:
+		frame = binary.BigEndian.AppendUint32(nil, uint32(len(msg)))
+		frame = append(frame, msg...)
+	case delimNull:
+		frame = append(append(frame, msg...), 0)
+	default:
+		frame = append(append(frame, msg...), '\n')
+	}
+	_, err := f.w.Write(frame)
+	return err
+}
+
+// splitFunc returns the split function for scanning the messages separated according to the delimiter
+func splitFunc(delim string) (bufio.SplitFunc, error) {
+	switch delim {
+	case "", delimLine:
+		return bufio.ScanLines, nil
+	case delimNull:
+		return scanNull, nil
+	case delimLength:
+		return scanLength, nil
+	default:
+		return nil, fmt.Errorf("unknown delimiter: %s, use one of: %s, %s, %s", delim, delimLine, delimNull, delimLength)
+	}
+}
+
+// scanNull is split function for messages separated by NUL character
+func scanNull(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// scanLength is split function for messages prefixed by 4-byte big-endian length
+func scanLength(data []byte, atEOF bool) (int, []byte, error) {
+	if len(data) >= 4 {
+		size := int(binary.BigEndian.Uint32(data))
+		if len(data) >= 4+size {
+			return 4 + size, data[4 : 4+size], nil
+		}
+	}
+	if atEOF && len(data) > 0 {
+		return 0, nil, errors.New("truncated message in input")
+	}
+	return 0, nil, nil
+}
+
+// sendAll sends all messages from in. The valid UTF-8 messages are sent as text, others (or all in binary mode) as binary.
+func (s *Session) sendAll(in io.Reader) error {
+	split, err := splitFunc(options.delimiter)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	scanner.Split(split)
+	for scanner.Scan() {
+		msgType := websocket.TextMessage
+		if options.binary != "" || !utf8.Valid(scanner.Bytes()) {
+			msgType = websocket.BinaryMessage
+		}
+		if err := s.sendData(msgType, scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("input reading error: %w", err)
+	}
+	return nil
+}
+
+// batch is the non-interactive session: it sends messages from in and writes the received payloads into out.
+// After the input end it waits for options.wait duration, options.count of received messages, message matching options.until or connection closure.
+// Without any of these conditions it waits for defaultWait or connection closure.
+func (s *Session) batch(url string, in io.Reader, out io.Writer) []error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ws, err := s.dial(ctx, url)
+	if err != nil {
+		return []error{err}
+	}
+	defer s.closeConn(ws)
+	defer s.printPingSummary()
+	s.setConn(ws)
+	s.cancel = cancel
+	s.errors = []error{}
+	s.raw = &framer{w: out, delim: options.delimiter}
+	defer s.startTimer()()
+	go func() {
+		sig := make(chan os.Signal, 2)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		fmt.Fprintf(os.Stderr, "\n%s signal received, exiting...\n", <-sig)
+		s.cancel()
+	}()
+	if err = s.setup(ctx, ws); err != nil {
+		return []error{err}
+	}
+	lost := make(chan error, 1)
+	go func() { lost <- s.readWebsocket() }()
+	defer s.startSchedules()()
+	sent := make(chan error, 1)
+	go func() { sent <- s.sendAll(in) }()
+	var timeout <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return s.getErr()
+		case err = <-sent:
+			if err != nil {
+				s.setErr(err)
+				return s.getErr()
+			}
+			switch {
+			case options.wait > 0:
+				timeout = time.After(options.wait)
+			case options.count == 0 && options.until == nil:
+				timeout = time.After(defaultWait)
+			}
+		case <-timeout:
+			if options.until != nil {
+				s.setErr(errors.New("the expected message is not received"))
+			}
+			return s.getErr()
+		case err = <-lost:
+			switch {
+			case options.until != nil && isNormalClose(err):
+				s.setErr(errors.New("connection closed before the expected message received"))
+			case !isCompleted(err) && !isNormalClose(err):
+				s.setErr(err)
+			}
+			return s.getErr()
+		}
+	}
+}
+
+// isNormalClose reports whether err is caused by the normal connection closure from server side
+func isNormalClose(err error) bool {
+	var closeErr *websocket.CloseError
+	return errors.As(err, &closeErr) && (closeErr.Code == websocket.CloseNormalClosure || closeErr.Code == websocket.CloseGoingAway)
+}
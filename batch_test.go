@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFramer(t *testing.T) {
+	for _, delim := range []string{delimLine, delimNull, delimLength} {
+		t.Run(delim, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			f := &framer{w: buf, delim: delim}
+			require.NoError(t, f.write([]byte("first")))
+			require.NoError(t, f.write([]byte("second message")))
+			split, err := splitFunc(delim)
+			require.NoError(t, err)
+			scanner := bufio.NewScanner(buf)
+			scanner.Split(split)
+			msgs := []string{}
+			for scanner.Scan() {
+				msgs = append(msgs, scanner.Text())
+			}
+			require.NoError(t, scanner.Err())
+			require.Equal(t, []string{"first", "second message"}, msgs)
+		})
+	}
+	_, err := splitFunc("comma")
+	require.EqualError(t, err, "unknown delimiter: comma, use one of: line, null, length")
+}
+
+func TestScanLengthTruncated(t *testing.T) {
+	scanner := bufio.NewScanner(bytes.NewReader([]byte{0, 0, 0, 10, 'a', 'b'}))
+	scanner.Split(scanLength)
+	require.False(t, scanner.Scan())
+	require.EqualError(t, scanner.Err(), "truncated message in input")
+}
+
+func TestBatchCount(t *testing.T) {
+	srv := newMockServer(0)
+	defer srv.Close()
+	options.count = 2
+	defer func() { options.count = 0 }()
+	srv.ToSend <- "a"
+	srv.ToSend <- "b"
+	out := &bytes.Buffer{}
+	s := &Session{}
+	errs := s.batch(mockURL, strings.NewReader("one\ntwo\n"), out)
+	require.Empty(t, errs)
+	require.Equal(t, "a\nb\n", out.String())
+	require.Eventually(t, func() bool { return len(srv.Received) == 2 }, 20*time.Millisecond, 2*time.Millisecond)
+	require.Equal(t, "one", <-srv.Received)
+	require.Equal(t, "two", <-srv.Received)
+}
+
+func TestBatchWait(t *testing.T) {
+	srv := newMockServer(0)
+	defer srv.Close()
+	options.wait = 50 * time.Millisecond
+	options.delimiter = delimNull
+	defer func() {
+		options.wait = 0
+		options.delimiter = ""
+	}()
+	out := &bytes.Buffer{}
+	s := &Session{}
+	time.AfterFunc(10*time.Millisecond, func() { srv.ToSend <- "reply" })
+	start := time.Now()
+	errs := s.batch(mockURL, strings.NewReader("request\x00"), out)
+	require.Empty(t, errs)
+	require.GreaterOrEqual(t, time.Since(start), options.wait)
+	require.Equal(t, "reply\x00", out.String())
+	require.Equal(t, "request", <-srv.Received)
+}
+
+func TestBatchDefaultWait(t *testing.T) {
+	srv := newMockServer(0)
+	defer srv.Close()
+	out := &bytes.Buffer{}
+	time.AfterFunc(50*time.Millisecond, func() { srv.ToSend <- "late reply" })
+	start := time.Now()
+	errs := (&Session{}).batch(mockURL, strings.NewReader("request\n"), out)
+	require.Empty(t, errs)
+	require.GreaterOrEqual(t, time.Since(start), defaultWait)
+	require.Equal(t, "late reply\n", out.String())
+}
+
+func TestBatchClosedByServer(t *testing.T) {
+	srv := newMockServer(0)
+	options.count = 1
+	defer func() { options.count = 0 }()
+	time.AfterFunc(20*time.Millisecond, func() { srv.Close() })
+	errs := (&Session{}).batch(mockURL, strings.NewReader(""), &bytes.Buffer{})
+	require.Empty(t, errs)
+}
+
+func TestBatchUntil(t *testing.T) {
+	srv := newMockServer(0)
+	defer srv.Close()
+	var err error
+	options.until, err = compileMatcher(`.status == "done"`)
+	require.NoError(t, err)
+	defer func() { options.until = nil }()
+	srv.ToSend <- `{"status":"pending"}`
+	srv.ToSend <- `{"status":"done"}`
+	srv.ToSend <- `{"status":"after"}`
+	out := &bytes.Buffer{}
+	errs := (&Session{}).batch(mockURL, strings.NewReader(""), out)
+	require.Empty(t, errs)
+	require.Equal(t, "{\"status\":\"pending\"}\n{\"status\":\"done\"}\n", out.String())
+}
+
+func TestBatchUntilGroup(t *testing.T) {
+	srv := newMockServer(0)
+	defer srv.Close()
+	var err error
+	options.until, err = compileMatcher(`(done|ready)`)
+	require.NoError(t, err)
+	defer func() { options.until = nil }()
+	srv.ToSend <- "pending"
+	srv.ToSend <- "ready"
+	srv.ToSend <- "after"
+	out := &bytes.Buffer{}
+	errs := (&Session{}).batch(mockURL, strings.NewReader(""), out)
+	require.Empty(t, errs)
+	require.Equal(t, "pending\nready\n", out.String())
+}
+
+func TestBatchUntilExtract(t *testing.T) {
+	srv := newMockServer(0)
+	defer srv.Close()
+	var err error
+	options.until, err = compileMatcher(`.status == "done"`)
+	require.NoError(t, err)
+	options.extract, err = compileQueryList(`.id`)
+	require.NoError(t, err)
+	defer func() { options.until, options.extract = nil, nil }()
+	srv.ToSend <- `{"id":1,"status":"pending"}`
+	srv.ToSend <- `{"id":2,"status":"done"}`
+	out := &bytes.Buffer{}
+	errs := (&Session{}).batch(mockURL, strings.NewReader(""), out)
+	require.Empty(t, errs)
+	require.Equal(t, "1\n2\n", out.String())
+}
+
+func TestBatchTimeout(t *testing.T) {
+	srv := newMockServer(0)
+	defer srv.Close()
+	var err error
+	options.until, err = compileMatcher(`done`)
+	require.NoError(t, err)
+	options.timeout = 30 * time.Millisecond
+	defer func() {
+		options.until = nil
+		options.timeout = 0
+	}()
+	srv.ToSend <- "pending"
+	start := time.Now()
+	errs := (&Session{}).batch(mockURL, strings.NewReader(""), &bytes.Buffer{})
+	require.GreaterOrEqual(t, time.Since(start), options.timeout)
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs[0], "timeout: no exit condition is met in 30ms")
+	require.Equal(t, exitTimeout, exitCode(errs))
+	require.Equal(t, exitError, exitCode([]error{errCountReached}))
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/spf13/cobra"
+)
+
+var benchOptions struct {
+	connections int
+	ramp        float64
+	rate        float64
+	duration    time.Duration
+	message     string
+}
+
+// benchStats collects the results of all benchmark connections
+type benchStats struct {
+	lock      sync.Mutex
+	connect   []time.Duration
+	rtt       []time.Duration
+	failed    int
+	sent      int
+	skipped   int
+	received  int
+	unmatched int
+	errors    map[string]int
+	closes    map[int]int
+}
+
+func newBenchCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bench URL",
+		Short: "open concurrent connections, send messages at the target rate and report latencies and throughput",
+		Args:  cobra.ExactArgs(1),
+		Run:   bench,
+	}
+	cmd.Flags().IntVarP(&benchOptions.connections, "connections", "n", 10, "number of concurrent connections")
+	cmd.Flags().Float64Var(&benchOptions.ramp, "ramp", 0, "connections opened per second (0 - all at once)")
+	cmd.Flags().Float64VarP(&benchOptions.rate, "rate", "r", 1, "messages per second sent by each connection (0 - connect only)")
+	cmd.Flags().DurationVarP(&benchOptions.duration, "duration", "d", 10*time.Second, "benchmark duration")
+	cmd.Flags().StringVarP(&benchOptions.message, "message", "m", `{"id": "${id}", "conn": ${conn}, "seq": ${seq}, "ts": ${ts}}`, "message template: ${id} is message token to match the reply, ${conn} is connection number, ${seq} is message number in connection, ${ts} is unix time in ms")
+	return cmd
+}
+
+func bench(cmd *cobra.Command, args []string) {
+	if benchOptions.connections <= 0 || benchOptions.ramp < 0 || benchOptions.rate < 0 || benchOptions.duration <= 0 {
+		fmt.Fprintln(os.Stderr, "incorrect benchmark parameters")
+		os.Exit(1)
+	}
+	if _, err := benchMessage(0, 0); err != nil {
+		fmt.Fprintf(os.Stderr, "message template error: %v\n", err)
+		os.Exit(1)
+	}
+	dest, err := prepare(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), benchOptions.duration)
+	defer cancel()
+	go func() {
+		sig := make(chan os.Signal, 2)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		fmt.Fprintf(os.Stderr, "\n%s signal received, stopping...\n", <-sig)
+		cancel()
+	}()
+	start := time.Now()
+	stopped := make(chan time.Time, 1)
+	context.AfterFunc(ctx, func() { stopped <- time.Now() })
+	stats := runBench(ctx, dest.String())
+	cancel() // all connections can fail before the end of duration
+	stats.report(os.Stdout, (<-stopped).Sub(start))
+	if options.jar != nil {
+		if err = options.jar.save(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	if len(stats.connect) == 0 {
+		fmt.Fprintln(os.Stderr, "no connections established")
+		os.Exit(1)
+	}
+}
+
+// benchTokenRe finds the message tokens (${id} template variable) in the replies
+var benchTokenRe = regexp.MustCompile(`ws-\d+-\d+`)
+
+// benchToken returns the unique token of message seq of connection conn
+func benchToken(conn, seq int) string {
+	return fmt.Sprintf("ws-%d-%d", conn, seq)
+}
+
+// benchMessage makes the message from template for connection conn and message number seq
+func benchMessage(conn, seq int) (string, error) {
+	return expand(benchOptions.message, map[string]string{
+		"id":   benchToken(conn, seq),
+		"conn": strconv.Itoa(conn),
+		"seq":  strconv.Itoa(seq),
+		"ts":   strconv.FormatInt(time.Now().UnixMilli(), 10),
+	})
+}
+
+// runBench opens benchOptions.connections connections with benchOptions.ramp rate and runs them until ctx is done
+func runBench(ctx context.Context, url string) *benchStats {
+	stats := &benchStats{errors: map[string]int{}, closes: map[int]int{}}
+	wg := sync.WaitGroup{}
+	for i := 0; i < benchOptions.connections; i++ {
+		if i > 0 && benchOptions.ramp > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Duration(float64(time.Second) / benchOptions.ramp)):
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(conn int) {
+			defer wg.Done()
+			stats.run(ctx, url, conn)
+		}(i)
+	}
+	wg.Wait()
+	return stats
+}
+
+// maxInflight limits the number of unanswered messages of connection
+const maxInflight = 1024
+
+// inflight is the sent messages of connection waiting for reply. The reply is matched to the sent message by token
+// (when template contains ${id}) or by the whole payload (for echo servers).
+type inflight struct {
+	lock  sync.Mutex
+	token bool
+	sent  map[string]time.Time
+}
+
+// add registers the sent message by its key, it returns false when there are too many unanswered messages
+func (f *inflight) add(key string) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if len(f.sent) >= maxInflight {
+		return false
+	}
+	f.sent[key] = time.Now()
+	return true
+}
+
+// remove forgets the message that is not sent
+func (f *inflight) remove(key string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.sent, key)
+}
+
+// match returns the round-trip time of the sent message that the reply answers
+func (f *inflight) match(reply string) (time.Duration, bool) {
+	keys := []string{reply}
+	if f.token {
+		keys = benchTokenRe.FindAllString(reply, -1)
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, key := range keys {
+		if sent, ok := f.sent[key]; ok {
+			delete(f.sent, key)
+			return time.Since(sent), true
+		}
+	}
+	return 0, false
+}
+
+// run is the single benchmark connection: it sends messages with benchOptions.rate and measures the round-trip time
+// as time between the sent message and the reply matched to it. The replies that are not matched are counted separately.
+func (b *benchStats) run(ctx context.Context, url string, conn int) {
+	start := time.Now()
+	ws, err := (&Session{deferJarSave: true, quiet: conn > 0}).dial(ctx, url)
+	if err != nil {
+		if ctx.Err() == nil {
+			b.add(func() {
+				b.failed++
+				b.errors[err.Error()]++
+			})
+		}
+		return
+	}
+	latency := time.Since(start)
+	b.add(func() { b.connect = append(b.connect, latency) })
+	pending := &inflight{token: strings.Contains(benchOptions.message, "${id}"), sent: map[string]time.Time{}}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			_, data, err := ws.ReadMessage()
+			if err != nil {
+				var closeErr *websocket.CloseError
+				switch {
+				case errors.As(err, &closeErr):
+					b.add(func() { b.closes[closeErr.Code]++ })
+				case ctx.Err() == nil:
+					b.add(func() { b.errors[fmt.Sprintf("reading error: %v", err)]++ })
+				}
+				return
+			}
+			rtt, matched := pending.match(string(data))
+			b.add(func() {
+				b.received++
+				if matched {
+					b.rtt = append(b.rtt, rtt)
+				} else {
+					b.unmatched++
+				}
+			})
+		}
+	}()
+	var tick <-chan time.Time
+	if benchOptions.rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / benchOptions.rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for seq := 0; ; seq++ {
+		select {
+		case <-ctx.Done():
+			TryCloseNormally(ws, "benchmark finished")
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+			}
+			ws.Close()
+			return
+		case <-done:
+			ws.Close()
+			return
+		case <-tick:
+			msg, _ := benchMessage(conn, seq)
+			key := msg
+			if pending.token {
+				key = benchToken(conn, seq)
+			}
+			if !pending.add(key) { // too many unanswered messages
+				b.add(func() { b.skipped++ })
+				continue
+			}
+			if err := ws.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+				pending.remove(key)
+				b.add(func() { b.errors[fmt.Sprintf("writing error: %v", err)]++ })
+				ws.Close()
+				<-done
+				return
+			}
+			b.add(func() { b.sent++ })
+		}
+	}
+}
+
+func (b *benchStats) add(f func()) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	f()
+}
+
+// report writes the benchmark results, the throughput is calculated for the elapsed time of benchmark
+func (b *benchStats) report(w io.Writer, duration time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	fmt.Fprintf(w, "connections: %d established, %d failed\n", len(b.connect), b.failed)
+	fmt.Fprintf(w, "connect latency: %s\n", latencySummary(b.connect))
+	seconds := duration.Seconds()
+	fmt.Fprintf(w, "messages: %d sent (%.1f msg/s), %d received (%.1f msg/s)\n", b.sent, float64(b.sent)/seconds, b.received, float64(b.received)/seconds)
+	if b.unmatched > 0 {
+		fmt.Fprintf(w, "received messages not matched to sent ones: %d\n", b.unmatched)
+	}
+	if b.skipped > 0 {
+		fmt.Fprintf(w, "messages not sent because of too many unanswered ones: %d\n", b.skipped)
+	}
+	fmt.Fprintf(w, "round-trip latency: %s\n", latencySummary(b.rtt))
+	if len(b.closes) > 0 {
+		codes := []string{}
+		for code, count := range b.closes {
+			codes = append(codes, fmt.Sprintf("%d: %d", code, count))
+		}
+		slices.Sort(codes)
+		fmt.Fprintf(w, "close codes: %s\n", strings.Join(codes, ", "))
+	}
+	if len(b.errors) > 0 {
+		errs := []string{}
+		for err := range b.errors {
+			errs = append(errs, err)
+		}
+		slices.Sort(errs)
+		fmt.Fprintln(w, "errors:")
+		for _, err := range errs {
+			fmt.Fprintf(w, "  %d x %s\n", b.errors[err], err)
+		}
+	}
+}
+
+// latencySummary returns min, average, percentiles and max of durations
+func latencySummary(durations []time.Duration) string {
+	if len(durations) == 0 {
+		return "no data"
+	}
+	sorted := slices.Clone(durations)
+	slices.Sort(sorted)
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	percentile := func(p int) time.Duration {
+		return sorted[(len(sorted)-1)*p/100]
+	}
+	return fmt.Sprintf("min %s, avg %s, p50 %s, p90 %s, p99 %s, max %s",
+		sorted[0].Round(time.Microsecond), (total / time.Duration(len(sorted))).Round(time.Microsecond),
+		percentile(50).Round(time.Microsecond), percentile(90).Round(time.Microsecond),
+		percentile(99).Round(time.Microsecond), sorted[len(sorted)-1].Round(time.Microsecond))
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatencySummary(t *testing.T) {
+	require.Equal(t, "no data", latencySummary(nil))
+	durations := []time.Duration{}
+	for i := 100; i > 0; i-- {
+		durations = append(durations, time.Duration(i)*time.Millisecond)
+	}
+	require.Equal(t, "min 1ms, avg 50.5ms, p50 50ms, p90 90ms, p99 99ms, max 100ms", latencySummary(durations))
+	require.Equal(t, 100*time.Millisecond, durations[0])
+}
+
+func TestBenchMessage(t *testing.T) {
+	defer func(message string) { benchOptions.message = message }(benchOptions.message)
+	benchOptions.message = `{"conn": ${conn}, "seq": ${seq}}`
+	msg, err := benchMessage(2, 7)
+	require.NoError(t, err)
+	require.Equal(t, `{"conn": 2, "seq": 7}`, msg)
+	benchOptions.message = "${unknown_variable}"
+	_, err = benchMessage(0, 0)
+	require.EqualError(t, err, "undefined variable 'unknown_variable'")
+}
+
+func TestInflight(t *testing.T) {
+	// token matching: unsolicited messages and replies to unknown tokens are not matched
+	f := &inflight{token: true, sent: map[string]time.Time{}}
+	require.True(t, f.add(benchToken(0, 0)))
+	require.True(t, f.add(benchToken(0, 1)))
+	_, matched := f.match(`{"type": "greeting"}`)
+	require.False(t, matched)
+	rtt, matched := f.match(`{"reply_to": "ws-0-1"}`)
+	require.True(t, matched)
+	require.Greater(t, rtt, time.Duration(0))
+	_, matched = f.match(`{"reply_to": "ws-0-1"}`)
+	require.False(t, matched)
+	_, matched = f.match(`{"reply_to": "ws-1-0"}`)
+	require.False(t, matched)
+	_, matched = f.match(`{"reply_to": "ws-0-0"}`)
+	require.True(t, matched)
+	// payload matching
+	f = &inflight{sent: map[string]time.Time{}}
+	require.True(t, f.add("0:0"))
+	_, matched = f.match("heartbeat")
+	require.False(t, matched)
+	_, matched = f.match("0:0")
+	require.True(t, matched)
+	// limit of unanswered messages
+	for i := range maxInflight {
+		require.True(t, f.add(strconv.Itoa(i)))
+	}
+	require.False(t, f.add("next"))
+	f.remove("0")
+	require.True(t, f.add("next"))
+}
+
+func TestBench(t *testing.T) {
+	newEchoServer(t)
+	defer func(opts struct {
+		connections int
+		ramp        float64
+		rate        float64
+		duration    time.Duration
+		message     string
+	}) {
+		benchOptions = opts
+	}(benchOptions)
+	benchOptions.connections = 3
+	benchOptions.ramp = 100
+	benchOptions.rate = 50
+	benchOptions.message = "${conn}:${seq}"
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	stats := runBench(ctx, mockURL)
+	require.Len(t, stats.connect, 3)
+	require.Greater(t, stats.sent, 10)
+	require.Greater(t, stats.received, 10)
+	require.NotEmpty(t, stats.rtt)
+	require.Zero(t, stats.skipped)
+	require.Zero(t, stats.unmatched)
+	require.Equal(t, map[int]int{1000: 3}, stats.closes)
+	require.Empty(t, stats.errors)
+	out := &bytes.Buffer{}
+	stats.report(out, 200*time.Millisecond)
+	require.Contains(t, out.String(), "connections: 3 established, 0 failed\nconnect latency: min ")
+	require.Contains(t, out.String(), "close codes: 1000: 3\n")
+	// connection errors
+	stats = runBench(context.Background(), "ws://127.0.0.1:1/ws")
+	require.Equal(t, 3, stats.failed)
+	out.Reset()
+	stats.report(out, time.Second)
+	require.Contains(t, out.String(), "connections: 0 established, 3 failed\nconnect latency: no data\n")
+	require.Contains(t, out.String(), "errors:\n  3 x dial tcp 127.0.0.1:1: connect: connection refused\n")
+	require.NotContains(t, out.String(), "messages not sent")
+	require.NotContains(t, out.String(), "not matched")
+	stats.skipped = 2
+	stats.unmatched = 3
+	out.Reset()
+	stats.report(out, time.Second)
+	require.Contains(t, out.String(), "messages not sent because of too many unanswered ones: 2\n")
+	require.Contains(t, out.String(), "received messages not matched to sent ones: 3\n")
+}
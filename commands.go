@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+// command is the console command that is typed as '/name arguments'
+type command struct {
+	usage string
+	help  string
+	run   func(s *Session, arg string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"ping":       {"[payload]", "send ping control frame", (*Session).cmdPing},
+		"close":      {"[code] [reason]", "send close frame (default code is 1000)", (*Session).cmdClose},
+		"binary":     {"<hex|base64> <data>", "send binary message with data decoded from hex or base64", (*Session).cmdBinary},
+		"file":       {"<path>", "send file content (as text when it is valid UTF-8 and not in binary mode, otherwise as binary)", (*Session).cmdFile},
+		"every":      {"<interval> <message>", "start sending the message each interval (see --send for placeholders)", (*Session).cmdEvery},
+		"schedules":  {"", "list the running periodic messages", (*Session).cmdSchedules},
+		"stop":       {"<number>|all", "stop the periodic message", (*Session).cmdStop},
+		"filter":     {"[regexp]", "print only received messages that match regexp, without regexp the filter is removed", (*Session).cmdFilter},
+		"text":       {"<message>", "send text message as is (without --binary or protobuf encoding)", (*Session).cmdText},
+		"timestamps": {"on|off", "switch printing of timestamps", (*Session).cmdTimestamps},
+		"help":       {"", "print this help", (*Session).cmdHelp},
+	}
+}
+
+// isCommand reports whether the console line is a command. Lines starting with '//' are the escaped messages.
+func isCommand(line string) bool {
+	return strings.HasPrefix(line, "/") && !strings.HasPrefix(line, "//")
+}
+
+// unescape removes the escaping '/' or '@' from the console line that starts with '//' or '@@'
+func unescape(line string) string {
+	if strings.HasPrefix(line, "//") || strings.HasPrefix(line, "@@") {
+		return line[1:]
+	}
+	return line
+}
+
+// lineMessage makes the message from the console line: '@path' is the file content ('@@' escapes the '@'), in binary mode the line
+// is decoded from options.binary encoding (hex or base64), with protobuf type the JSON line is encoded to protobuf, otherwise the line is sent as text.
+func lineMessage(line string) (int, []byte, error) {
+	if strings.HasPrefix(line, "@") && !strings.HasPrefix(line, "@@") {
+		return fileMessage(line[1:])
+	}
+	line = unescape(line)
+	switch {
+	case options.binary != "":
+		data, err := decodeBinary(options.binary, line)
+		return websocket.BinaryMessage, data, err
+	case options.proto != nil:
+		data, err := options.proto.encode(line)
+		return websocket.BinaryMessage, data, err
+	}
+	return websocket.TextMessage, []byte(line), nil
+}
+
+// runCommand executes the console command line. The argument is passed as is, the commands trim it when they need.
+func (s *Session) runCommand(line string) error {
+	name, arg, _ := strings.Cut(strings.TrimPrefix(line, "/"), " ")
+	cmd, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command: /%s, type /help for the list of commands", name)
+	}
+	return cmd.run(s, arg)
+}
+
+func (s *Session) cmdPing(arg string) error {
+	return s.sendPing(arg, s.output())
+}
+
+// sendPing sends the ping control frame and logs it into out
+func (s *Session) sendPing(arg string, out io.Writer) error {
+	if err := s.conn().WriteControl(websocket.PingMessage, []byte(arg), time.Now().Add(time.Second)); err != nil {
+		return fmt.Errorf("ping sending error: `%w`", err)
+	}
+	s.rec.record(event{Event: evPing, Direction: dirSent, Payload: arg})
+	fmt.Fprint(out, ctSprintf("%s > ping: %s\n", s.getPrefix(), arg))
+	return nil
+}
+
+func (s *Session) cmdClose(arg string) error {
+	return s.sendClose(arg, s.output())
+}
+
+// sendClose sends the close frame with code and reason from arg and logs it into out
+func (s *Session) sendClose(arg string, out io.Writer) error {
+	code := websocket.CloseNormalClosure
+	codeStr, reason, _ := strings.Cut(strings.TrimSpace(arg), " ")
+	if codeStr != "" {
+		var err error
+		if code, err = strconv.Atoi(codeStr); err != nil || !validCloseCode(code) {
+			return fmt.Errorf("incorrect close code: %s", codeStr)
+		}
+	}
+	msg := websocket.FormatCloseMessage(code, reason)
+	if err := s.conn().WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second)); err != nil {
+		return fmt.Errorf("close sending error: `%w`", err)
+	}
+	s.rec.recordClose(dirSent, code, reason)
+	fmt.Fprint(out, ctSprintf("%s > close: %d %s\n", s.getPrefix(), code, reason))
+	return nil
+}
+
+// validCloseCode reports whether the close code can be sent: 1004, 1005, 1006 and 1015 are reserved by RFC 6455,
+// 1016-2999 are not assigned, 3000-4999 are for libraries and applications
+func validCloseCode(code int) bool {
+	return code >= 1000 && code <= 1003 || code >= 1007 && code <= 1014 || code >= 3000 && code <= 4999
+}
+
+func (s *Session) cmdBinary(arg string) error {
+	encoding, data, _ := strings.Cut(strings.TrimSpace(arg), " ")
+	decoded, err := decodeBinary(encoding, strings.TrimSpace(data))
+	if err != nil {
+		return err
+	}
+	return s.sendData(websocket.BinaryMessage, decoded)
+}
+
+func (s *Session) cmdText(arg string) error {
+	if arg == "" {
+		return fmt.Errorf("use: /text <message>")
+	}
+	return s.sendMsg(arg)
+}
+
+// binary data encodings
+const (
+	encHex    = "hex"
+	encBase64 = "base64"
+)
+
+// decodeBinary decodes data in encoding: hex (spaces are allowed between bytes) or base64 (padding is optional)
+func decodeBinary(encoding, data string) ([]byte, error) {
+	if encoding != encHex && encoding != encBase64 {
+		return nil, fmt.Errorf("unknown encoding: '%s', use hex or base64", encoding)
+	}
+	if data == "" {
+		return nil, fmt.Errorf("no data to send")
+	}
+	if encoding == encHex {
+		decoded, err := hex.DecodeString(strings.ReplaceAll(data, " ", ""))
+		if err != nil {
+			return nil, fmt.Errorf("incorrect hex data: %w", err)
+		}
+		return decoded, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		if decoded, err = base64.RawStdEncoding.DecodeString(data); err != nil {
+			return nil, fmt.Errorf("incorrect base64 data: %w", err)
+		}
+	}
+	return decoded, nil
+}
+
+func (s *Session) cmdFile(arg string) error {
+	msgType, data, err := fileMessage(strings.TrimSpace(arg))
+	if err != nil {
+		return err
+	}
+	return s.sendData(msgType, data)
+}
+
+// fileMessage reads the file content. It is binary message in binary mode or when the content is not valid UTF-8.
+func fileMessage(path string) (int, []byte, error) {
+	if path == "" {
+		return 0, nil, fmt.Errorf("file path is required")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, nil, fmt.Errorf("reading file error: %w", err)
+	}
+	if options.binary != "" || !utf8.Valid(data) {
+		return websocket.BinaryMessage, data, nil
+	}
+	return websocket.TextMessage, data, nil
+}
+
+func (s *Session) cmdFilter(arg string) error {
+	arg = strings.TrimSpace(arg)
+	v := s.getView()
+	if arg == "" {
+		v.filter = nil
+		s.view.Store(&v)
+		fmt.Fprint(s.output(), ctSprintf("filter removed\n"))
+		return nil
+	}
+	re, err := regexp.Compile(arg)
+	if err != nil {
+		return fmt.Errorf("compiling regexp '%s' error: %w", arg, err)
+	}
+	v.filter = re
+	s.view.Store(&v)
+	fmt.Fprint(s.output(), ctSprintf("filter set to: %s\n", arg))
+	return nil
+}
+
+func (s *Session) cmdTimestamps(arg string) error {
+	v := s.getView()
+	arg = strings.TrimSpace(arg)
+	switch arg {
+	case "on":
+		v.timestamp = true
+	case "off":
+		v.timestamp = false
+	default:
+		return fmt.Errorf("use: /timestamps on|off")
+	}
+	s.view.Store(&v)
+	fmt.Fprint(s.output(), ctSprintf("timestamps %s\n", arg))
+	return nil
+}
+
+func (s *Session) cmdHelp(string) error {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	help := "commands:\n"
+	for _, name := range names {
+		cmd := commands[name]
+		help += fmt.Sprintf("  /%-28s %s\n", strings.TrimSpace(name+" "+cmd.usage), cmd.help)
+	}
+	help += fmt.Sprintf("  %-29s %s\n", "@path", "send file content like /file")
+	help += fmt.Sprintf("  %-29s %s\n", "//text", "send text that starts with '/'")
+	help += fmt.Sprintf("  %-29s %s\n", "@@text", "send text that starts with '@'")
+	fmt.Fprint(s.output(), ctSprintf("%s", help))
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chzyer/readline"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeBinary(t *testing.T) {
+	data, err := decodeBinary("hex", "01 02 ff")
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 2, 255}, data)
+	data, err = decodeBinary("base64", "AQL/")
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 2, 255}, data)
+	data, err = decodeBinary("base64", "AQL")
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 2}, data)
+	data, err = decodeBinary("base64", "AAAA")
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 0, 0}, data)
+	_, err = decodeBinary("hex", "")
+	require.EqualError(t, err, "no data to send")
+	_, err = decodeBinary("AAAA", "")
+	require.EqualError(t, err, "unknown encoding: 'AAAA', use hex or base64")
+	_, err = decodeBinary("hex", "AQL/")
+	require.ErrorContains(t, err, "incorrect hex data: ")
+	_, err = decodeBinary("base64", "not encoded!")
+	require.ErrorContains(t, err, "incorrect base64 data: ")
+}
+
+func TestLineMessage(t *testing.T) {
+	dir := t.TempDir()
+	text, bin := filepath.Join(dir, "text"), filepath.Join(dir, "bin")
+	require.NoError(t, os.WriteFile(text, []byte("file content"), 0o600))
+	require.NoError(t, os.WriteFile(bin, []byte{0, 0xff}, 0o600))
+	for _, binary := range []string{"", encHex} {
+		options.binary = binary
+		msgType, data, err := lineMessage("@" + bin)
+		require.NoError(t, err)
+		require.Equal(t, websocket.BinaryMessage, msgType)
+		require.Equal(t, []byte{0, 0xff}, data)
+		msgType, data, err = lineMessage("@" + text)
+		require.NoError(t, err)
+		require.Equal(t, map[string]int{"": websocket.TextMessage, encHex: websocket.BinaryMessage}[binary], msgType)
+		require.Equal(t, "file content", string(data))
+	}
+	options.binary = ""
+	msgType, data, err := lineMessage("@@mention")
+	require.NoError(t, err)
+	require.Equal(t, websocket.TextMessage, msgType)
+	require.Equal(t, "@mention", string(data))
+	_, _, err = lineMessage("@" + filepath.Join(dir, "mistyped"))
+	require.ErrorContains(t, err, "reading file error: ")
+	_, _, err = lineMessage("@" + dir)
+	require.ErrorContains(t, err, "reading file error: ")
+	_, _, err = lineMessage("@")
+	require.EqualError(t, err, "file path is required")
+	options.binary = encHex
+	defer func() { options.binary = "" }()
+	msgType, data, err = lineMessage("de ad")
+	require.NoError(t, err)
+	require.Equal(t, websocket.BinaryMessage, msgType)
+	require.Equal(t, []byte{0xde, 0xad}, data)
+	_, _, err = lineMessage("not encoded!")
+	require.ErrorContains(t, err, "incorrect hex data: ")
+	options.binary = encBase64
+	msgType, data, err = lineMessage("AAAA")
+	require.NoError(t, err)
+	require.Equal(t, websocket.BinaryMessage, msgType)
+	require.Equal(t, []byte{0, 0, 0}, data)
+}
+
+func TestCommands(t *testing.T) {
+	srv := newMockServer(0)
+	defer srv.Close()
+	conn := newMockConn()
+	defer TryCloseNormally(conn, "test finished")
+	outR, outW, _ := os.Pipe()
+	rl, err := readline.NewEx(&readline.Config{Prompt: "> ", Stdout: outW, FuncMakeRaw: success, FuncExitRaw: success})
+	require.NoError(t, err)
+	s := &Session{ws: conn, rl: rl, cancel: func() {}}
+	file := filepath.Join(t.TempDir(), "msg")
+	require.NoError(t, os.WriteFile(file, []byte("file content"), 0o600))
+
+	require.True(t, isCommand("/help"))
+	require.False(t, isCommand("//help"))
+	require.False(t, isCommand("text"))
+	require.Equal(t, "/help", unescape("//help"))
+	require.Equal(t, "text", unescape("text"))
+
+	require.NoError(t, s.runCommand("/help"))
+	require.NoError(t, s.runCommand("/ping hello"))
+	require.NoError(t, s.runCommand("/binary hex 74 65 73 74"))
+	require.Eventually(t, func() bool { return len(srv.Received) > 0 }, 20*time.Millisecond, 2*time.Millisecond)
+	require.Equal(t, "test", <-srv.Received)
+	require.NoError(t, s.runCommand("/file "+file))
+	require.Eventually(t, func() bool { return len(srv.Received) > 0 }, 20*time.Millisecond, 2*time.Millisecond)
+	require.Equal(t, "file content", <-srv.Received)
+	require.NoError(t, s.runCommand("/filter ^abc "))
+	require.Equal(t, "^abc", s.getView().filter.String())
+	require.NoError(t, s.runCommand("/filter"))
+	require.Nil(t, s.getView().filter)
+	options.binary = encHex
+	require.NoError(t, s.runCommand("/text  raw text "))
+	options.binary = ""
+	require.Eventually(t, func() bool { return len(srv.Received) > 0 }, 20*time.Millisecond, 2*time.Millisecond)
+	require.Equal(t, " raw text ", <-srv.Received)
+	require.NoError(t, s.runCommand("/timestamps on"))
+	require.True(t, s.getView().timestamp)
+	require.NoError(t, s.runCommand("/timestamps off"))
+	require.False(t, s.getView().timestamp)
+
+	require.EqualError(t, s.runCommand("/unknown"), "unknown command: /unknown, type /help for the list of commands")
+	require.EqualError(t, s.runCommand("/timestamps maybe"), "use: /timestamps on|off")
+	require.EqualError(t, s.runCommand("/text"), "use: /text <message>")
+	require.EqualError(t, s.runCommand("/filter }])"), "compiling regexp '}])' error: error parsing regexp: unexpected ): `}])`")
+	require.EqualError(t, s.runCommand("/file"), "file path is required")
+	require.EqualError(t, s.runCommand("/binary hex"), "no data to send")
+	require.EqualError(t, s.runCommand("/binary 74 65"), "unknown encoding: '74', use hex or base64")
+	require.EqualError(t, s.runCommand("/close 10"), "incorrect close code: 10")
+	for _, code := range []string{"1004", "1005", "1006", "1015", "1016", "2999", "5000"} {
+		require.EqualError(t, s.runCommand("/close "+code), "incorrect close code: "+code)
+	}
+	require.NoError(t, s.runCommand("/close 4000 bye"))
+
+	outW.Close()
+	output, err := io.ReadAll(outR)
+	require.NoError(t, err)
+	out := string(output)
+	require.Contains(t, out, "  /close [code] [reason]        send close frame (default code is 1000)\n")
+	require.Contains(t, out, "timestamps on\n")
+	require.Contains(t, out, "timestamps off\n")
+	require.Contains(t, out, "  //text                        send text that starts with '/'\n")
+	require.Contains(t, out, "  @path                         send file content like /file\n")
+	require.Contains(t, out, " > ping: hello")
+	require.Contains(t, out, " > close: 4000 bye")
+}
@@ -7,11 +7,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -27,12 +30,71 @@ type Session struct {
 	cancel  func()
 	errors  []error
 	errLock sync.Mutex
+	wsLock  sync.RWMutex
+	// writeLock serializes the messages writing: gorilla/websocket allows only one concurrent writer
+	writeLock sync.Mutex
+	// raw is the output for received payloads in pipe mode
+	raw      *framer
+	received atomic.Int64
+	// rec records the session events into transcript
+	rec *recorder
+	// pings collects the ping round-trip times when pinging is on
+	pings *pingStats
+	// schedules are the running periodic message senders
+	schedules schedules
+	// deferJarSave turns off the cookie jar saving after dial, the jar is saved by caller (bench saves it once after all connections)
+	deferJarSave bool
+	// quiet turns off the connection info (proxy, handshake, subprotocol) printed by dial, bench prints it only for the first connection
+	quiet bool
+	// view is the output settings changed by /filter and /timestamps, nil means the options values
+	view atomic.Pointer[view]
+}
+
+// view is the output settings that can be changed from console while the messages are being received
+type view struct {
+	filter    *regexp.Regexp
+	timestamp bool
+}
+
+// getView returns the current output settings of session
+func (s *Session) getView() view {
+	if v := s.view.Load(); v != nil {
+		return *v
+	}
+	return view{filter: options.filter, timestamp: options.timestamp}
+}
+
+var (
+	// errCountReached is returned by readWebsocket when the requested number of messages is received
+	errCountReached = errors.New("requested number of messages received")
+	// errMatched is returned by readWebsocket when the message matching options.until is received
+	errMatched = errors.New("expected message received")
+	// errTimeout is reported when no exit condition is met in options.timeout
+	errTimeout = errors.New("timeout")
+)
+
+// isCompleted reports whether the session is finished because of the exit condition is met
+func isCompleted(err error) bool {
+	return errors.Is(err, errCountReached) || errors.Is(err, errMatched)
+}
+
+// startTimer cancels the session with errTimeout after options.timeout. It returns the function that stops the timer.
+func (s *Session) startTimer() func() bool {
+	if options.timeout <= 0 {
+		return func() bool { return false }
+	}
+	timer := time.AfterFunc(options.timeout, func() {
+		s.setErr(fmt.Errorf("%w: no exit condition is met in %s", errTimeout, options.timeout))
+		s.cancel()
+	})
+	return timer.Stop
 }
 
 func (s *Session) setErr(err error) {
 	s.errLock.Lock()
 	defer s.errLock.Unlock()
 	s.errors = append(s.errors, err)
+	s.rec.recordErr(err)
 }
 
 func (s *Session) getErr() []error {
@@ -47,12 +109,13 @@ var (
 	rxSprintf = color.New(color.FgGreen).SprintfFunc()
 	txSprintf = color.New(color.FgBlue).SprintfFunc()
 	ctSprintf = color.New(color.FgRed).SprintfFunc()
+	arSprintf = color.New(color.FgMagenta).SprintfFunc()
 )
 
 const tsFormat = "20060102T150405.999"
 
-func getPrefix() string {
-	if options.timestamp {
+func (s *Session) getPrefix() string {
+	if s.getView().timestamp {
 		prefix := time.Now().UTC().Format(tsFormat)
 		if len(prefix) < 19 {
 			prefix += strings.Repeat("0", 19-len(prefix))
@@ -62,71 +125,240 @@ func getPrefix() string {
 	return ""
 }
 
-func (s *Session) connect(url string) []error {
-	headers := make(http.Header)
-	headers.Add("Origin", options.origin)
-	if options.authHeader != "" {
+func (s *Session) dial(ctx context.Context, url string) (*websocket.Conn, error) {
+	headers := options.headers.Clone()
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	if headers.Get("Origin") == "" {
+		headers.Add("Origin", options.origin)
+	}
+	if options.authHeader != "" && headers.Get("Authorization") == "" {
 		headers.Add("Authorization", options.authHeader)
 	}
+	tlsConfig := options.tlsConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{InsecureSkipVerify: options.insecure}
+	}
+	proxy := &proxyTracker{proxy: options.proxy}
 	dialer := websocket.Dialer{
-		Proxy: http.ProxyFromEnvironment,
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: options.insecure,
-		},
+		Proxy:             proxy.choose,
+		TLSClientConfig:   tlsConfig,
 		EnableCompression: options.compression,
-		Subprotocols:      []string{options.subProtocals},
+		Subprotocols:      options.subProtocols,
+		NetDialContext:    options.netDial,
+	}
+	if netFlags.unixSocket != "" {
+		dialer.Proxy = nil
+	}
+	if options.jar != nil {
+		dialer.Jar = options.jar
+	}
+	ws, resp, err := dialer.DialContext(ctx, url, headers)
+	err = newHandshakeError(explainTLSError(err), resp)
+	info := s.output()
+	if s.quiet {
+		info = io.Discard
+	}
+	if options.jar != nil && !s.deferJarSave {
+		if saveErr := options.jar.save(); saveErr != nil {
+			fmt.Fprint(s.output(), ctSprintf("%v\n", saveErr))
+		}
+	}
+	if proxy.used != nil {
+		if err != nil {
+			err = fmt.Errorf("%w (via proxy %s)", err, proxy.used.Redacted())
+		} else {
+			fmt.Fprint(info, ctSprintf("connected via proxy %s\n", proxy.used.Redacted()))
+		}
+	} else if options.verbose && err == nil {
+		fmt.Fprint(info, ctSprintf("proxy: none\n"))
 	}
+	if resp != nil {
+		e := event{Event: evOpen, URL: url, Status: resp.Status, Request: redactHeaders(headers), Response: redactHeaders(resp.Header)}
+		if resp.Request != nil {
+			e.Request = redactHeaders(resp.Request.Header)
+		}
+		s.rec.record(e)
+		if options.verbose {
+			fmt.Fprint(info, ctSprintf("%s", handshakeInfo(ws, resp)))
+		}
+	}
+	if err == nil && len(options.subProtocols) > 0 {
+		if ws.Subprotocol() == "" && options.requireProto {
+			ws.Close()
+			err = fmt.Errorf("server didn't select any of offered subprotocols: %s", strings.Join(options.subProtocols, ", "))
+		} else if !options.verbose {
+			fmt.Fprint(info, ctSprintf("subprotocol: %s\n", valueOrNone(ws.Subprotocol())))
+		}
+	}
+	s.rec.recordErr(err)
+	return ws, err
+}
+
+func (s *Session) connect(url string) []error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	ws, _, err := dialer.DialContext(ctx, url, headers)
+	ws, err := s.dial(ctx, url)
 	if err != nil {
 		return []error{err}
 	}
 	defer func() {
+		s.printPingSummary()
 		s.rl.Close()
-		TryCloseNormally(ws, "client disconnection")
-		ws.Close()
+		s.closeConn(s.conn())
 	}()
-	s.ws = ws
-	s.cancel =  cancel
-	s.errors =  []error{}
-	if options.pingPong {
-		ws.SetPingHandler(func(appData string) error {
-			fmt.Fprint(s.rl.Stdout(), ctSprintf("%s < ping: %s\n", getPrefix(), appData))
-			err := ws.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(time.Second))
-			if err != nil {
-				return err
+	s.setConn(ws)
+	s.cancel = cancel
+	s.errors = []error{}
+	defer s.startTimer()()
+	go func() {
+		sig := make(chan os.Signal, 2)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		fmt.Fprintf(s.output(), "\n%s signal received, exiting...\n", <-sig)
+		s.rl.Close()
+		s.cancel()
+	}()
+
+	go s.readConsole()
+	defer s.stopSchedules()
+	for {
+		err = s.serve(ctx, ws)
+		if ctx.Err() != nil || isCompleted(err) {
+			return s.getErr()
+		}
+		if !options.reconnect {
+			s.setErr(err)
+			return s.getErr()
+		}
+		fmt.Fprint(s.output(), ctSprintf("%s%v\n", s.getPrefix(), err))
+		s.rec.recordErr(err)
+		ws.Close()
+		if ws, err = s.reconnect(ctx, url); err != nil {
+			if ctx.Err() == nil {
+				s.setErr(err)
 			}
-			fmt.Fprint(s.rl.Stdout(), ctSprintf("%s > pong: %s\n", getPrefix(), appData))
-			return nil
-		})
-		ws.SetPongHandler(func(appData string) error {
-			fmt.Fprint(s.rl.Stdout(), ctSprintf("%s < pong: %s\n", getPrefix(), appData))
-			return nil
-		})
+			return s.getErr()
+		}
+		s.setConn(ws)
+	}
+}
+
+// serve handles the connection until it is lost or ctx is canceled. It returns the reason of disconnection.
+func (s *Session) serve(ctx context.Context, ws *websocket.Conn) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if err := s.setup(ctx, ws); err != nil {
+		return err
+	}
+	s.schedules.once.Do(func() { s.startSchedules() }) // after the init message of the first connection
+	lost := make(chan error, 1)
+	go func() { lost <- s.readWebsocket() }()
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-lost:
+		return err
 	}
+}
+
+// setup prepares the freshly established connection: sets ping/pong handlers, starts pinging and sends the init message
+func (s *Session) setup(ctx context.Context, ws *websocket.Conn) error {
+	ws.SetPingHandler(func(appData string) error {
+		s.rec.record(event{Event: evPing, Direction: dirReceived, Payload: appData})
+		if options.pingPong {
+			fmt.Fprint(s.output(), ctSprintf("%s < ping: %s\n", s.getPrefix(), appData))
+		}
+		err := ws.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(time.Second))
+		if err != nil {
+			// the same as gorilla/websocket default handler: the pong is not sent because the connection is closing or slow
+			var netErr net.Error
+			if errors.Is(err, websocket.ErrCloseSent) || errors.As(err, &netErr) && netErr.Timeout() {
+				return nil
+			}
+			return err
+		}
+		s.rec.record(event{Event: evPong, Direction: dirSent, Payload: appData})
+		if options.pingPong {
+			fmt.Fprint(s.output(), ctSprintf("%s > pong: %s\n", s.getPrefix(), appData))
+		}
+		return nil
+	})
+	ws.SetPongHandler(func(appData string) error {
+		s.rec.record(event{Event: evPong, Direction: dirReceived, Payload: appData})
+		rtt, matched := time.Duration(0), false
+		if s.pings != nil {
+			rtt, matched = s.pings.pong(appData)
+		}
+		if options.pingPong {
+			if matched {
+				fmt.Fprint(s.output(), ctSprintf("%s < pong: %s (rtt %s)\n", s.getPrefix(), appData, rtt.Round(time.Microsecond)))
+			} else {
+				fmt.Fprint(s.output(), ctSprintf("%s < pong: %s\n", s.getPrefix(), appData))
+			}
+		}
+		return nil
+	})
 	if options.pingInterval != 0 {
+		if s.pings == nil {
+			s.pings = newPingStats()
+		} else {
+			s.pings.reset()
+		}
 		go s.pingHandler(ctx)
 	}
 	if options.initMsg != "" {
-		if err = s.sendMsg(options.initMsg); err != nil {
-			return []error{err}
+		msgType, data, err := initMessage()
+		if err != nil {
+			return err
+		}
+		if err = s.sendData(msgType, data); err != nil {
+			return err
 		}
 	}
-	go func() {
-		sig := make(chan os.Signal, 2)
-		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
-		fmt.Printf("\n%s signal received, exiting...\n", <-sig)
-		s.rl.Close()
-		s.cancel()
-	}()
+	return nil
+}
 
-	go s.readConsole()
-	go s.readWebsocket()
-	<-ctx.Done()
-	return s.getErr()
+// initMessage makes the connection init message: with protobuf type the JSON is encoded to protobuf, otherwise it is sent as text
+func initMessage() (int, []byte, error) {
+	if options.proto != nil {
+		data, err := options.proto.encode(options.initMsg)
+		return websocket.BinaryMessage, data, err
+	}
+	return websocket.TextMessage, []byte(options.initMsg), nil
 }
 
+// output returns the writer for console output. Without console (in pipe mode) it is stderr.
+func (s *Session) output() io.Writer {
+	if s.rl == nil {
+		return os.Stderr
+	}
+	return s.rl.Stdout()
+}
+
+// closeConn tries to close the connection normally and then closes it
+func (s *Session) closeConn(ws *websocket.Conn) {
+	reason := "client disconnection"
+	if TryCloseNormally(ws, reason) == nil {
+		s.rec.recordClose(dirSent, websocket.CloseNormalClosure, reason)
+	}
+	ws.Close()
+}
+
+func (s *Session) conn() *websocket.Conn {
+	s.wsLock.RLock()
+	defer s.wsLock.RUnlock()
+	return s.ws
+}
+
+func (s *Session) setConn(ws *websocket.Conn) {
+	s.wsLock.Lock()
+	defer s.wsLock.Unlock()
+	s.ws = ws
+}
+
+// pingHandler sends the numbered pings each options.pingInterval. When options.maxMissedPongs pings are left
+// unanswered it marks the connection as dead and closes it.
 func (s *Session) pingHandler(ctx context.Context) {
 	ticker := time.NewTicker(options.pingInterval)
 	defer ticker.Stop()
@@ -135,27 +367,61 @@ func (s *Session) pingHandler(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			err := s.ws.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(time.Second))
+			if options.maxMissedPongs > 0 && s.pings.unanswered() >= options.maxMissedPongs {
+				s.pings.markDead()
+				s.conn().Close()
+				return
+			}
+			payload := s.pings.next()
+			err := s.conn().WriteControl(websocket.PingMessage, []byte(payload), time.Now().Add(time.Second))
 			if err != nil {
-				fmt.Printf("ping sending error: `%v`", err)
+				err = fmt.Errorf("ping sending error: `%w`", err)
+				fmt.Fprint(s.output(), ctSprintf("%v\n", err))
 				s.setErr(err)
 				return
 			}
+			s.rec.record(event{Event: evPing, Direction: dirSent, Payload: payload})
 			if options.pingPong {
-				fmt.Fprint(s.rl.Stdout(), ctSprintf("%s > ping: \n", getPrefix()))
+				fmt.Fprint(s.output(), ctSprintf("%s > ping: %s\n", s.getPrefix(), payload))
 			}
 		}
 	}
 }
 
+// printPingSummary prints the pings statistics when pinging is on
+func (s *Session) printPingSummary() {
+	if s.pings != nil {
+		fmt.Fprintln(s.output(), s.pings.summary(options.pingInterval))
+	}
+}
+
 func (s *Session) sendMsg(msg string) error {
-	err := s.ws.WriteMessage(websocket.TextMessage, []byte(msg))
+	return s.sendData(websocket.TextMessage, []byte(msg))
+}
+
+func (s *Session) sendData(msgType int, data []byte) error {
+	if err := s.write(msgType, data); err != nil {
+		return err
+	}
+	if s.getView().timestamp { // repeat sent massage only if timestamp is required
+		text := string(data)
+		if msgType == websocket.BinaryMessage {
+			text = "\n" + hex.Dump(data)
+		}
+		fmt.Fprint(s.output(), formatMessage(s.getPrefix()+"> ", text, txSprintf))
+	}
+	return nil
+}
+
+// write writes the message into connection and records it
+func (s *Session) write(msgType int, data []byte) error {
+	s.writeLock.Lock()
+	err := s.conn().WriteMessage(msgType, data)
+	s.writeLock.Unlock()
 	if err != nil {
 		return fmt.Errorf("writing error: `%w`", err)
 	}
-	if options.timestamp { // repeat sent massage only if timestamp is required
-		fmt.Fprint(s.rl.Stdout(), txSprintf("%s> %s\n", getPrefix(), msg))
-	}
+	s.rec.record(messageEvent(dirSent, msgType, data))
 	return nil
 }
 
@@ -169,44 +435,96 @@ func (s *Session) readConsole() {
 			}
 			return
 		}
-		if err = s.sendMsg(line); err != nil {
+		if isCommand(line) {
+			if err = s.runCommand(line); err != nil {
+				fmt.Fprint(s.output(), ctSprintf("%s%v\n", s.getPrefix(), err))
+			}
+			continue
+		}
+		msgType, data, err := lineMessage(line)
+		if err != nil {
+			fmt.Fprint(s.output(), ctSprintf("%s%v\n", s.getPrefix(), err))
+			continue
+		}
+		if err = s.sendData(msgType, data); err != nil {
+			if options.reconnect {
+				fmt.Fprint(s.output(), ctSprintf("%s%v\n", s.getPrefix(), err))
+				continue
+			}
 			s.setErr(err)
 			return
 		}
 	}
 }
 
-func (s *Session) readWebsocket() {
-	defer s.cancel()
-	defer s.rl.Close()
+// readWebsocket reads and prints the incoming messages until the connection is lost. It returns the reason of disconnection.
+func (s *Session) readWebsocket() error {
+	ws := s.conn()
 	for {
-		msgType, buf, err := s.ws.ReadMessage()
+		msgType, buf, err := ws.ReadMessage()
 		if err != nil {
+			if s.pings != nil && s.pings.isDead() {
+				return fmt.Errorf("connection is dead: %d pings are not answered", options.maxMissedPongs)
+			}
+			if closeErr, ok := err.(*websocket.CloseError); ok {
+				s.rec.recordClose(dirReceived, closeErr.Code, closeErr.Text)
+			}
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure, websocket.CloseServiceRestart) {
-				s.setErr(fmt.Errorf("reading error: `%v`", err))
-			} else {
-				s.setErr(fmt.Errorf("connection closed: %s", err))
+				return fmt.Errorf("reading error: `%v`", err)
 			}
-			return
+			return fmt.Errorf("connection closed: %w", err)
 		}
+		e := messageEvent(dirReceived, msgType, buf)
+		e.Time = time.Now().UTC()
+		s.rec.recordReceived(e)
 		var text string
 		switch msgType {
 		case websocket.TextMessage:
 			text = string(buf)
 		case websocket.BinaryMessage:
-			if options.binAsText {
+			if decoded, ok := decodeMessage(buf); ok {
+				text, buf = decoded, []byte(decoded)
+			} else if options.binAsText {
 				text = string(buf)
 			} else {
 				text = "\n" + hex.Dump(buf)
 			}
 		default:
-			s.setErr(fmt.Errorf("unknown websocket frame type: %d", msgType))
-			return
+			return fmt.Errorf("unknown websocket frame type: %d", msgType)
+		}
+		if err = s.respond(text); err != nil {
+			return err
+		}
+		if filter := s.getView().filter; filter != nil && !filter.MatchString(text) {
+			continue
 		}
-		if options.filter != nil && !options.filter.MatchString(text) {
+		shown, selected := selectMessage(text)
+		if !selected {
 			continue
 		}
-		fmt.Fprint(s.rl.Stdout(), rxSprintf("%s< %s\n", getPrefix(), text))
+		switch {
+		case options.output == outputNDJSON:
+			if options.extract != nil { // the extracted values are the message of output
+				size := len(shown)
+				e.Type, e.Payload, e.Size = "text", shown, &size
+			}
+			s.rec.output(e)
+		case s.raw != nil:
+			if options.extract != nil {
+				buf = []byte(shown)
+			}
+			if err = s.raw.write(buf); err != nil {
+				return fmt.Errorf("output writing error: %w", err)
+			}
+		default:
+			fmt.Fprint(s.output(), formatMessage(s.getPrefix()+"< ", shown, rxSprintf))
+		}
+		if options.until != nil && options.until.match(text) {
+			return errMatched
+		}
+		if options.count > 0 && s.received.Add(1) >= int64(options.count) {
+			return errCountReached
+		}
 	}
 }
 
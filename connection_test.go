@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"io"
+	"net"
 	"os"
 	"regexp"
 	"sync"
@@ -19,11 +21,11 @@ func success() error { return nil }
 func TestGetPrefix(t *testing.T) {
 	options.timestamp = true
 	defer func() { options.timestamp = false }()
-	prefix := getPrefix()
+	prefix := (&Session{}).getPrefix()
 	require.Contains(t, prefix, " ")
 	require.Len(t, prefix, 20)
 	options.timestamp = false
-	prefix = getPrefix()
+	prefix = (&Session{}).getPrefix()
 	require.Empty(t, prefix)
 }
 
@@ -164,3 +166,20 @@ func TestInitMsg(t *testing.T) {
 	s.cancel()
 	require.Empty(t, <-errs)
 }
+
+func TestPingHandlerPongError(t *testing.T) {
+	m := newMockServer(0)
+	defer m.Close()
+	conn := newMockConn()
+	s := &Session{}
+	require.NoError(t, s.setup(context.Background(), conn))
+	// no error when the pong can't be sent after close message
+	require.NoError(t, conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second)))
+	require.NoError(t, conn.PingHandler()("ping"))
+	conn.Close()
+	// other errors are returned
+	conn = newMockConn()
+	require.NoError(t, s.setup(context.Background(), conn))
+	conn.Close()
+	require.ErrorIs(t, conn.PingHandler()("ping"), net.ErrClosed)
+}
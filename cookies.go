@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cookieFlags are raw cookie options
+var cookieFlags struct {
+	cookies   []string
+	jarFile   string
+	loginURL  string
+	loginData string
+}
+
+// httpOnlyPrefix marks the HttpOnly cookies in Netscape cookies file
+const httpOnlyPrefix = "#HttpOnly_"
+
+// jar is the cookie jar that keeps track of all stored cookies to be able to save them into Netscape cookies file
+type jar struct {
+	lock    sync.Mutex
+	jar     *cookiejar.Jar
+	file    string
+	cookies map[string]*jarCookie
+}
+
+// jarCookie is the stored cookie with its scope
+type jarCookie struct {
+	domain   string
+	hostOnly bool
+	path     string
+	secure   bool
+	httpOnly bool
+	expires  time.Time
+	name     string
+	value    string
+}
+
+// newJar creates the cookie jar from cookieFlags for dest URL. It returns nil when no cookie options are set.
+// The cookies are loaded from the jar file, then the cookies from --cookie are added and the login request is made.
+func newJar(dest *url.URL) (*jar, error) {
+	if len(cookieFlags.cookies) == 0 && cookieFlags.jarFile == "" && cookieFlags.loginURL == "" {
+		return nil, nil
+	}
+	inner, _ := cookiejar.New(nil)
+	j := &jar{jar: inner, file: cookieFlags.jarFile, cookies: map[string]*jarCookie{}}
+	if j.file != "" {
+		if err := j.load(); err != nil {
+			return nil, err
+		}
+	}
+	httpURL := *dest
+	httpURL.Scheme = strings.Replace(httpURL.Scheme, "ws", "http", 1)
+	for _, item := range cookieFlags.cookies {
+		cookies, err := http.ParseCookie(item)
+		if err != nil {
+			return nil, fmt.Errorf("incorrect cookie '%s': %w", item, err)
+		}
+		j.SetCookies(&httpURL, cookies)
+	}
+	if cookieFlags.loginURL != "" {
+		if err := j.login(); err != nil {
+			return nil, err
+		}
+	}
+	return j, nil
+}
+
+// Cookies implements http.CookieJar
+func (j *jar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// SetCookies implements http.CookieJar. It stores the cookies into inner jar and keeps track of them.
+func (j *jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	for _, c := range cookies {
+		jc := &jarCookie{
+			domain:   strings.ToLower(strings.TrimPrefix(c.Domain, ".")),
+			path:     c.Path,
+			secure:   c.Secure,
+			httpOnly: c.HttpOnly,
+			expires:  c.Expires,
+			name:     c.Name,
+			value:    c.Value,
+		}
+		if jc.domain == "" {
+			jc.domain, jc.hostOnly = strings.ToLower(u.Hostname()), true
+		}
+		if jc.path == "" || !strings.HasPrefix(jc.path, "/") {
+			jc.path = defaultCookiePath(u.Path)
+		}
+		if c.MaxAge > 0 {
+			jc.expires = time.Now().Add(time.Duration(c.MaxAge) * time.Second)
+		}
+		key := jc.domain + ";" + jc.path + ";" + jc.name
+		if c.MaxAge < 0 || !jc.expires.IsZero() && jc.expires.Before(time.Now()) {
+			delete(j.cookies, key)
+			continue
+		}
+		j.cookies[key] = jc
+	}
+}
+
+// defaultCookiePath returns the cookie path for request path (RFC 6265 section 5.1.4)
+func defaultCookiePath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.Count(path, "/") == 1 {
+		return "/"
+	}
+	return path[:strings.LastIndex(path, "/")]
+}
+
+// load reads the Netscape cookies file. Missing file is not an error: it will be created on save.
+func (j *jar) load() error {
+	file, err := os.Open(j.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cookie jar reading error: %w", err)
+	}
+	defer file.Close()
+	if err = j.read(file); err != nil {
+		return fmt.Errorf("cookie jar %s: %w", j.file, err)
+	}
+	return nil
+}
+
+// read reads cookies in Netscape format: domain, include subdomains, path, secure, expires, name, value separated by tabs
+func (j *jar) read(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		httpOnly := strings.HasPrefix(line, httpOnlyPrefix)
+		line = strings.TrimPrefix(line, httpOnlyPrefix)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) == 6 { // empty value
+			fields = append(fields, "")
+		}
+		if len(fields) != 7 {
+			return fmt.Errorf("line %d: 7 tab separated fields expected", n)
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return fmt.Errorf("line %d: incorrect expiration time: %s", n, fields[4])
+		}
+		c := &http.Cookie{Path: fields[2], Secure: fields[3] == "TRUE", HttpOnly: httpOnly, Name: fields[5], Value: fields[6]}
+		if expires > 0 {
+			c.Expires = time.Unix(expires, 0)
+		}
+		domain := strings.TrimPrefix(fields[0], ".")
+		if fields[1] == "TRUE" {
+			c.Domain = domain
+		}
+		scheme := "http"
+		if c.Secure {
+			scheme = "https"
+		}
+		j.SetCookies(&url.URL{Scheme: scheme, Host: domain, Path: c.Path}, []*http.Cookie{c})
+	}
+	return scanner.Err()
+}
+
+// write writes the cookies (except the expired ones) in Netscape format
+func (j *jar) write(w io.Writer) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	keys := make([]string, 0, len(j.cookies))
+	for key := range j.cookies {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	b := &strings.Builder{}
+	b.WriteString("# Netscape HTTP Cookie File\n")
+	for _, key := range keys {
+		c := j.cookies[key]
+		if !c.expires.IsZero() && c.expires.Before(time.Now()) {
+			continue
+		}
+		domain, subdomains := c.domain, "FALSE"
+		if !c.hostOnly {
+			domain, subdomains = "."+domain, "TRUE"
+		}
+		if c.httpOnly {
+			domain = httpOnlyPrefix + domain
+		}
+		var expires int64
+		if !c.expires.IsZero() {
+			expires = c.expires.Unix()
+		}
+		fmt.Fprintf(b, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", domain, subdomains, c.path, strings.ToUpper(strconv.FormatBool(c.secure)), expires, c.name, c.value)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// save writes the cookies into the jar file when it is set
+func (j *jar) save() error {
+	if j.file == "" {
+		return nil
+	}
+	file, err := os.OpenFile(j.file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("cookie jar writing error: %w", err)
+	}
+	if err = j.write(file); err != nil {
+		file.Close()
+		return fmt.Errorf("cookie jar writing error: %w", err)
+	}
+	return file.Close()
+}
+
+// login makes the HTTP request to cookieFlags.loginURL (POST with cookieFlags.loginData or GET) and stores the received cookies
+func (j *jar) login() error {
+	method, body := http.MethodGet, io.Reader(nil)
+	if cookieFlags.loginData != "" {
+		method, body = http.MethodPost, strings.NewReader(cookieFlags.loginData)
+	}
+	req, err := http.NewRequest(method, cookieFlags.loginURL, body)
+	if err != nil {
+		return fmt.Errorf("login request error: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if strings.HasPrefix(strings.TrimSpace(cookieFlags.loginData), "{") {
+			req.Header.Set("Content-Type", "application/json")
+		}
+	}
+	client := &http.Client{
+		Jar:     j,
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			Proxy:           (&proxyTracker{proxy: options.proxy}).choose,
+			DialContext:     options.netDial,
+			TLSClientConfig: options.tlsConfig,
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("login request error: %w", explainTLSError(err))
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxMessageSize))
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("login request failed: %s", resp.Status)
+	}
+	return nil
+}
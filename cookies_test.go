@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJarReadWrite(t *testing.T) {
+	j, err := newJar(nil)
+	require.NoError(t, err)
+	require.Nil(t, j)
+	j = mustJar(t)
+	src := "# Netscape HTTP Cookie File\n" +
+		".example.com\tTRUE\t/\tTRUE\t4102444800\tsid\tabc\n" +
+		"#HttpOnly_api.example.com\tFALSE\t/ws\tFALSE\t0\ttoken\txyz\n" +
+		"old.example.com\tFALSE\t/\tFALSE\t1000\texpired\tvalue\n" +
+		"\n# comment\n" +
+		"example.com\tFALSE\t/\tFALSE\t0\tempty\n"
+	require.NoError(t, j.read(strings.NewReader(src)))
+	out := &bytes.Buffer{}
+	require.NoError(t, j.write(out))
+	require.Equal(t, "# Netscape HTTP Cookie File\n"+
+		"#HttpOnly_api.example.com\tFALSE\t/ws\tFALSE\t0\ttoken\txyz\n"+
+		"example.com\tFALSE\t/\tFALSE\t0\tempty\t\n"+
+		".example.com\tTRUE\t/\tTRUE\t4102444800\tsid\tabc\n", out.String())
+	u, _ := url.Parse("https://api.example.com/ws/feed")
+	names := []string{}
+	for _, c := range j.Cookies(u) {
+		names = append(names, c.Name)
+	}
+	require.ElementsMatch(t, []string{"sid", "token"}, names)
+	require.EqualError(t, j.read(strings.NewReader("a\tb\n")), "line 1: 7 tab separated fields expected")
+	require.EqualError(t, j.read(strings.NewReader("a\tTRUE\t/\tTRUE\tnever\tn\tv\n")), "line 1: incorrect expiration time: never")
+}
+
+func mustJar(t *testing.T) *jar {
+	cookieFlags.cookies = []string{"a=1"}
+	defer func() { cookieFlags.cookies = nil }()
+	dest, _ := url.Parse("ws://localhost/")
+	j, err := newJar(dest)
+	require.NoError(t, err)
+	j.cookies = map[string]*jarCookie{}
+	return j
+}
+
+func TestCookies(t *testing.T) {
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.FormValue("user") != "guest" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/", HttpOnly: true})
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		session, err := r.Cookie("session")
+		if err != nil || session.Value != "s1" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if extra, err := r.Cookie("extra"); err != nil || extra.Value != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, http.Header{"Set-Cookie": {"seen=yes; Max-Age=3600"}})
+		if err == nil {
+			conn.Close()
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	jarFile := filepath.Join(t.TempDir(), "cookies.txt")
+	cookieFlags.jarFile = jarFile
+	cookieFlags.cookies = []string{"extra=1"}
+	cookieFlags.loginURL = srv.URL + "/login"
+	cookieFlags.loginData = "user=guest"
+	defer func() {
+		cookieFlags.jarFile = ""
+		cookieFlags.cookies = nil
+		cookieFlags.loginURL = ""
+		cookieFlags.loginData = ""
+		options.jar = nil
+	}()
+	dest, _ := url.Parse("ws" + strings.TrimPrefix(srv.URL, "http") + "/ws")
+	var err error
+	options.jar, err = newJar(dest)
+	require.NoError(t, err)
+	// the jar saving is left to caller
+	require.NoError(t, os.RemoveAll(jarFile))
+	ws, err := (&Session{deferJarSave: true}).dial(context.Background(), dest.String())
+	require.NoError(t, err)
+	ws.Close()
+	require.NoFileExists(t, jarFile)
+	ws, err = (&Session{}).dial(context.Background(), dest.String())
+	require.NoError(t, err)
+	ws.Close()
+	data, err := os.ReadFile(jarFile)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "#HttpOnly_127.0.0.1\tFALSE\t/\tFALSE\t0\tsession\ts1\n")
+	require.Contains(t, string(data), "127.0.0.1\tFALSE\t/\tFALSE\t0\textra\t1\n")
+	require.Contains(t, string(data), "\tseen\tyes\n")
+	// the session is restored from the jar file without login
+	cookieFlags.loginURL = ""
+	options.jar, err = newJar(dest)
+	require.NoError(t, err)
+	ws, err = (&Session{}).dial(context.Background(), dest.String())
+	require.NoError(t, err)
+	ws.Close()
+	// failed login
+	cookieFlags.loginURL = srv.URL + "/login"
+	cookieFlags.loginData = "user=admin"
+	_, err = newJar(dest)
+	require.EqualError(t, err, "login request failed: 401 Unauthorized")
+	cookieFlags.loginURL = ""
+	cookieFlags.cookies = []string{"bad cookie"}
+	_, err = newJar(dest)
+	require.ErrorContains(t, err, "incorrect cookie 'bad cookie': ")
+}
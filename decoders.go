@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// decoder converts the binary message payload. The decoders are chained by --decode option, like 'gzip,json'.
+type decoder func([]byte) ([]byte, error)
+
+var decoders = map[string]decoder{
+	"gzip":    decodeGzip,
+	"zlib":    decodeZlib,
+	"deflate": decodeDeflate,
+	"base64":  decodeBase64,
+	"msgpack": decodeMsgpack,
+	"cbor":    decodeCBOR,
+	"json":    compactJSON,
+	"proto":   decodeProto,
+}
+
+// compileDecoders makes the decoders chain from comma separated decoder names
+func compileDecoders(expr string) ([]decoder, error) {
+	chain := []decoder{}
+	for _, name := range strings.Split(expr, ",") {
+		name = strings.TrimSpace(name)
+		d, ok := decoders[name]
+		if !ok {
+			names := make([]string, 0, len(decoders))
+			for name := range decoders {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			return nil, fmt.Errorf("unknown decoder: %s, use one of: %s", name, strings.Join(names, ", "))
+		}
+		if name == "proto" && options.proto == nil {
+			return nil, errors.New("proto decoder requires --proto-descriptor and --proto-type")
+		}
+		chain = append(chain, d)
+	}
+	return chain, nil
+}
+
+// decodeMessage applies options.decoders chain to the binary message. It reports false when there are no decoders,
+// any decoder fails or the result is not a text.
+func decodeMessage(data []byte) (string, bool) {
+	if len(options.decoders) == 0 {
+		return "", false
+	}
+	var err error
+	for _, d := range options.decoders {
+		if data, err = d(data); err != nil {
+			return "", false
+		}
+	}
+	return string(data), utf8.Valid(data)
+}
+
+// decompress reads the decompressed data, the result size is limited by maxMessageSize
+func decompress(r io.ReadCloser, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, maxMessageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxMessageSize {
+		return nil, errors.New("decompressed message is too big")
+	}
+	return data, nil
+}
+
+func decodeGzip(data []byte) ([]byte, error) {
+	return decompress(gzip.NewReader(bytes.NewReader(data)))
+}
+
+func decodeZlib(data []byte) ([]byte, error) {
+	return decompress(zlib.NewReader(bytes.NewReader(data)))
+}
+
+func decodeDeflate(data []byte) ([]byte, error) {
+	return decompress(flate.NewReader(bytes.NewReader(data)), nil)
+}
+
+// decodeBase64 shows the payload as base64 text
+func decodeBase64(data []byte) ([]byte, error) {
+	return []byte(base64.StdEncoding.EncodeToString(data)), nil
+}
+
+func decodeMsgpack(data []byte) ([]byte, error) {
+	var value any
+	if err := msgpack.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonCompatible(value))
+}
+
+func decodeCBOR(data []byte) ([]byte, error) {
+	var value any
+	if err := cbor.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonCompatible(value))
+}
+
+// compactJSON checks that payload is JSON and compacts it
+func compactJSON(data []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := json.Compact(buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeProto(data []byte) ([]byte, error) {
+	text, err := options.proto.decode(data)
+	return []byte(text), err
+}
+
+// jsonCompatible converts the maps with non-string keys (allowed in MessagePack and CBOR) into maps with string keys
+func jsonCompatible(value any) any {
+	switch v := value.(type) {
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = jsonCompatible(item)
+		}
+		return m
+	case map[string]any:
+		for key, item := range v {
+			v[key] = jsonCompatible(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = jsonCompatible(item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func compress(t *testing.T, newWriter func(io.Writer) io.WriteCloser, data string) []byte {
+	buf := &bytes.Buffer{}
+	w := newWriter(buf)
+	_, err := w.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestCompileDecoders(t *testing.T) {
+	chain, err := compileDecoders("gzip, json")
+	require.NoError(t, err)
+	require.Len(t, chain, 2)
+	_, err = compileDecoders("gzip,zip")
+	require.EqualError(t, err, "unknown decoder: zip, use one of: base64, cbor, deflate, gzip, json, msgpack, proto, zlib")
+	_, err = compileDecoders("proto")
+	require.EqualError(t, err, "proto decoder requires --proto-descriptor and --proto-type")
+}
+
+func TestDecodeMessage(t *testing.T) {
+	defer func() { options.decoders = nil }()
+	msg := `{"symbol": "BTC", "price": 64000.5}`
+	packed, err := msgpack.Marshal(map[string]any{"symbol": "BTC", "price": 64000.5})
+	require.NoError(t, err)
+	cborData, err := cbor.Marshal(map[any]any{"symbol": "BTC", 1: []any{true, nil}})
+	require.NoError(t, err)
+	for _, tc := range []struct {
+		chain string
+		data  []byte
+		exp   string
+	}{
+		{"gzip,json", compress(t, func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }, msg), `{"symbol":"BTC","price":64000.5}`},
+		{"zlib", compress(t, func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }, msg), msg},
+		{"deflate", compress(t, func(w io.Writer) io.WriteCloser { w2, _ := flate.NewWriter(w, flate.BestSpeed); return w2 }, msg), msg},
+		{"base64", []byte{0, 1, 0xff}, "AAH/"},
+		{"msgpack", packed, `{"price":64000.5,"symbol":"BTC"}`},
+		{"cbor", cborData, `{"1":[true,null],"symbol":"BTC"}`},
+	} {
+		options.decoders, err = compileDecoders(tc.chain)
+		require.NoError(t, err)
+		text, ok := decodeMessage(tc.data)
+		require.True(t, ok, tc.chain)
+		require.Equal(t, tc.exp, text, tc.chain)
+	}
+	options.decoders, _ = compileDecoders("gzip")
+	_, ok := decodeMessage([]byte("not compressed"))
+	require.False(t, ok)
+	options.decoders, _ = compileDecoders("json")
+	_, ok = decodeMessage([]byte("{"))
+	require.False(t, ok)
+	options.decoders = nil
+	_, ok = decodeMessage([]byte("{}"))
+	require.False(t, ok)
+}
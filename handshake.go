@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxRejectionBody is the maximal length of the rejection body shown in error
+const maxRejectionBody = 512
+
+// rejectionHeaders are the response headers that explain the handshake rejection
+var rejectionHeaders = []string{"Content-Type", "Location", "Retry-After", "Sec-Websocket-Version", "Upgrade", "Www-Authenticate"}
+
+// handshakeError is the handshake rejected by server with HTTP response
+type handshakeError struct {
+	status  string
+	code    int
+	headers http.Header
+	body    string
+}
+
+// newHandshakeError makes handshakeError from the response of failed handshake. It returns err as is when it is not the bad handshake.
+func newHandshakeError(err error, resp *http.Response) error {
+	if !errors.Is(err, websocket.ErrBadHandshake) || resp == nil {
+		return err
+	}
+	e := &handshakeError{status: resp.Status, code: resp.StatusCode, headers: http.Header{}}
+	for _, name := range rejectionHeaders {
+		if values := resp.Header.Values(name); len(values) > 0 {
+			e.headers[name] = values
+		}
+	}
+	if resp.Body != nil {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxRejectionBody+1))
+		e.body = strings.TrimSpace(string(body))
+		if len(body) > maxRejectionBody {
+			e.body = strings.TrimSpace(string(body[:maxRejectionBody])) + "..."
+		}
+	}
+	return e
+}
+
+func (e *handshakeError) Error() string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "handshake rejected: %s", e.status)
+	for _, name := range rejectionHeaders {
+		for _, value := range e.headers[name] {
+			fmt.Fprintf(b, "\n  %s: %s", name, value)
+		}
+	}
+	if e.body != "" {
+		fmt.Fprintf(b, "\n  %s", strings.ReplaceAll(e.body, "\n", "\n  "))
+	}
+	return b.String()
+}
+
+func (e *handshakeError) Unwrap() error {
+	return websocket.ErrBadHandshake
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/chzyer/readline"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandshakeRejection(t *testing.T) {
+	status, body := http.StatusUnauthorized, `{"error": "token expired"}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		w.Header().Set("X-Other", "not shown")
+		w.WriteHeader(status)
+		w.Write([]byte(body + "\n"))
+	}))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	_, err := (&Session{}).dial(context.Background(), url)
+	require.EqualError(t, err, "handshake rejected: 401 Unauthorized\n  Content-Type: application/json\n  Www-Authenticate: Bearer error=\"invalid_token\"\n  {\"error\": \"token expired\"}")
+	require.True(t, errors.Is(err, websocket.ErrBadHandshake))
+	require.Equal(t, exitUnauthorized, exitCode([]error{err}))
+	status, body = http.StatusServiceUnavailable, strings.Repeat("x", 1000)
+	_, err = (&Session{}).dial(context.Background(), url)
+	require.True(t, strings.HasSuffix(err.Error(), "\n  "+strings.Repeat("x", maxRejectionBody)+"..."))
+	require.Equal(t, exitServerError, exitCode([]error{err}))
+	for code, exit := range map[int]int{403: exitForbidden, 404: exitNotFound, 426: exitUpgradeRequired, 429: exitTooManyRequests, 400: exitError} {
+		status = code
+		_, err = (&Session{}).dial(context.Background(), url)
+		require.Equal(t, exit, exitCode([]error{err}), code)
+	}
+}
+
+func TestSubprotocols(t *testing.T) {
+	upgrader := websocket.Upgrader{Subprotocols: []string{"v2", "v3"}, CheckOrigin: func(*http.Request) bool { return true }}
+	offered := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offered = websocket.Subprotocols(r)
+		if conn, err := upgrader.Upgrade(w, r, nil); err == nil {
+			conn.Close()
+		}
+	}))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	defer func() {
+		options.subProtocols = nil
+		options.requireProto = false
+	}()
+	ws, err := (&Session{}).dial(context.Background(), url)
+	require.NoError(t, err)
+	ws.Close()
+	require.Empty(t, offered)
+	options.subProtocols = []string{"v1", "v3", "v2"}
+	ws, err = (&Session{}).dial(context.Background(), url)
+	require.NoError(t, err)
+	ws.Close()
+	require.Equal(t, []string{"v1", "v3", "v2"}, offered)
+	require.Equal(t, "v2", ws.Subprotocol())
+	// quiet session doesn't print the connection info
+	outR, outW, _ := os.Pipe()
+	rl, err := readline.NewEx(&readline.Config{Prompt: "> ", Stdout: outW, FuncMakeRaw: success, FuncExitRaw: success})
+	require.NoError(t, err)
+	for _, quiet := range []bool{true, false} {
+		ws, err = (&Session{rl: rl, quiet: quiet}).dial(context.Background(), url)
+		require.NoError(t, err)
+		ws.Close()
+	}
+	outW.Close()
+	output, err := io.ReadAll(outR)
+	require.NoError(t, err)
+	require.Equal(t, 1, strings.Count(string(output), "subprotocol: v2"))
+	options.subProtocols = []string{"v1"}
+	options.requireProto = true
+	_, err = (&Session{}).dial(context.Background(), url)
+	require.EqualError(t, err, "server didn't select any of offered subprotocols: v1")
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// reservedHeaders are formed by websocket dialer itself and can't be set by user
+var reservedHeaders = []string{"Upgrade", "Connection", "Sec-Websocket-Key", "Sec-Websocket-Version", "Sec-Websocket-Extensions"}
+
+// parseHeaders parses the list of 'Name: value' strings into http.Header.
+// Item in form '@path' loads headers from file (one header per line, empty lines and lines started with '#' are skipped).
+// Repeated headers are collected as multiple values of the same header.
+func parseHeaders(list []string) (http.Header, error) {
+	headers := make(http.Header)
+	for _, item := range list {
+		if path, ok := strings.CutPrefix(item, "@"); ok {
+			if err := readHeadersFile(path, headers); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := addHeader(headers, item); err != nil {
+			return nil, err
+		}
+	}
+	return headers, nil
+}
+
+func readHeadersFile(path string, headers http.Header) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("reading headers file error: %w", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := addHeader(headers, line); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+	}
+	return scanner.Err()
+}
+
+func addHeader(headers http.Header, header string) error {
+	name, value, found := strings.Cut(header, ":")
+	if !found {
+		return fmt.Errorf("incorrect header '%s': it must be in form 'Name: value'", header)
+	}
+	if !isToken(name) {
+		return fmt.Errorf("incorrect header name '%s'", name)
+	}
+	for _, r := range reservedHeaders {
+		if strings.EqualFold(name, r) {
+			return fmt.Errorf("header '%s' can't be set", name)
+		}
+	}
+	value = strings.TrimSpace(value)
+	for _, c := range value {
+		if c < ' ' && c != '\t' || c == 0x7f {
+			return fmt.Errorf("incorrect value of header '%s': control characters are not allowed", name)
+		}
+	}
+	headers.Add(name, value)
+	return nil
+}
+
+// isToken reports whether s is a valid token according to RFC 7230
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", c)) {
+			return false
+		}
+	}
+	return true
+}
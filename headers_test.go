@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHeaders(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "headers")
+	require.NoError(t, os.WriteFile(file, []byte("# comment\nX-Tenant-ID: 42\n\nCookie: a=b\n"), 0o600))
+	headers, err := parseHeaders([]string{"X-Api-Key: secret", "X-Multi: 1", "x-multi:2", "@" + file, "X-Empty:"})
+	require.NoError(t, err)
+	require.Equal(t, http.Header{
+		"X-Api-Key":   {"secret"},
+		"X-Multi":     {"1", "2"},
+		"X-Tenant-Id": {"42"},
+		"Cookie":      {"a=b"},
+		"X-Empty":     {""},
+	}, headers)
+}
+
+func TestParseHeadersErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "headers")
+	require.NoError(t, os.WriteFile(file, []byte("X-Good: 1\nbad header\n"), 0o600))
+	testCases := []struct {
+		header string
+		err    string
+	}{
+		{"no colon", "incorrect header 'no colon': it must be in form 'Name: value'"},
+		{": value", "incorrect header name ''"},
+		{"Bad Name: value", "incorrect header name 'Bad Name'"},
+		{"Upgrade: h2c", "header 'Upgrade' can't be set"},
+		{"sec-websocket-key: key", "header 'sec-websocket-key' can't be set"},
+		{"X-Ctrl: a\x01b", "incorrect value of header 'X-Ctrl': control characters are not allowed"},
+		{"@" + file, file + ":2: incorrect header 'bad header': it must be in form 'Name: value'"},
+		{"@/not/existing/file", "reading headers file error: open /not/existing/file: no such file or directory"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.header, func(t *testing.T) {
+			_, err := parseHeaders([]string{tc.header})
+			require.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func TestDialHeaders(t *testing.T) {
+	received := make(chan http.Header, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer srv.Close()
+	options.origin = srv.URL
+	options.authHeader = "Bearer token"
+	options.headers = http.Header{"X-Api-Key": {"secret"}, "Authorization": {"Basic abc"}}
+	defer func() {
+		options.origin = ""
+		options.authHeader = ""
+		options.headers = nil
+	}()
+	s := &Session{}
+	ws, err := s.dial(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http"))
+	require.NoError(t, err)
+	ws.Close()
+	headers := <-received
+	require.Equal(t, "secret", headers.Get("X-Api-Key"))
+	require.Equal(t, []string{"Basic abc"}, headers.Values("Authorization"))
+	require.Equal(t, srv.URL, headers.Get("Origin"))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// netFlags are raw network options
+var netFlags struct {
+	unixSocket string
+	resolve    []string
+	localAddr  string
+	ipv4       bool
+	ipv6       bool
+}
+
+// dialFunc is the function that makes the network connection for dialer
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// unixURL converts the 'ws+unix:///path/to.sock:/request/path' URL into 'ws://localhost/request/path' and
+// stores the socket path into netFlags.unixSocket. Other URLs are returned as is.
+func unixURL(dest *url.URL) (*url.URL, error) {
+	scheme, isUnix := strings.CutSuffix(dest.Scheme, "+unix")
+	if !isUnix {
+		return dest, nil
+	}
+	socket, path, _ := strings.Cut(dest.Path, ":")
+	if socket == "" || dest.Host != "" {
+		return nil, fmt.Errorf("incorrect unix socket URL: %s, expected like ws+unix:///path/to.sock:/request/path", dest)
+	}
+	if path == "" {
+		path = "/"
+	}
+	netFlags.unixSocket = socket
+	res := *dest
+	res.Scheme, res.Host, res.Path, res.RawPath = scheme, "localhost", path, ""
+	return &res, nil
+}
+
+// parseResolve parses the 'host:port:addr' overrides into the map of 'host:port' to 'addr:port'
+func parseResolve(list []string) (map[string]string, error) {
+	res := map[string]string{}
+	for _, item := range list {
+		parts := strings.SplitN(item, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("incorrect resolve value '%s', expected host:port:addr", item)
+		}
+		if _, err := strconv.ParseUint(parts[1], 10, 16); err != nil {
+			return nil, fmt.Errorf("incorrect port in resolve value '%s'", item)
+		}
+		addr := strings.TrimSuffix(strings.TrimPrefix(parts[2], "["), "]")
+		if net.ParseIP(addr) == nil {
+			return nil, fmt.Errorf("incorrect address in resolve value '%s'", item)
+		}
+		res[net.JoinHostPort(parts[0], parts[1])] = net.JoinHostPort(addr, parts[1])
+	}
+	return res, nil
+}
+
+// newDialFunc makes the dialFunc that applies netFlags. It returns nil when no network options are set.
+func newDialFunc() (dialFunc, error) {
+	if netFlags.unixSocket == "" && len(netFlags.resolve) == 0 && netFlags.localAddr == "" && !netFlags.ipv4 && !netFlags.ipv6 {
+		return nil, nil
+	}
+	if netFlags.ipv4 && netFlags.ipv6 {
+		return nil, errors.New("-4 and -6 can't be used together")
+	}
+	if netFlags.unixSocket != "" && (netFlags.localAddr != "" || len(netFlags.resolve) > 0 || netFlags.ipv4 || netFlags.ipv6) {
+		return nil, errors.New("unix socket can't be used with --resolve, --local-addr, -4 or -6")
+	}
+	resolve, err := parseResolve(netFlags.resolve)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{}
+	if netFlags.localAddr != "" {
+		ip := net.ParseIP(netFlags.localAddr)
+		if ip == nil {
+			return nil, fmt.Errorf("incorrect local address: %s", netFlags.localAddr)
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	family := ""
+	switch {
+	case netFlags.ipv4:
+		family = "tcp4"
+	case netFlags.ipv6:
+		family = "tcp6"
+	}
+	socket := netFlags.unixSocket
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if socket != "" {
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+		if override, ok := resolve[addr]; ok {
+			addr = override
+		}
+		if family != "" {
+			network = family
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/slytomcat/ws/server"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnixURL(t *testing.T) {
+	defer func() { netFlags.unixSocket = "" }()
+	for raw, expected := range map[string]string{
+		"ws+unix:///run/app.sock:/path?a=1": "ws://localhost/path?a=1",
+		"wss+unix:///run/app.sock":          "wss://localhost/",
+		"ws://example.com/path":             "ws://example.com/path",
+	} {
+		netFlags.unixSocket = ""
+		dest, _ := url.Parse(raw)
+		res, err := unixURL(dest)
+		require.NoError(t, err)
+		require.Equal(t, expected, res.String())
+		if dest.Scheme != res.Scheme {
+			require.Equal(t, "/run/app.sock", netFlags.unixSocket)
+		}
+	}
+	for _, raw := range []string{"ws+unix://host/run/app.sock:/path", "ws+unix:"} {
+		dest, _ := url.Parse(raw)
+		_, err := unixURL(dest)
+		require.EqualError(t, err, "incorrect unix socket URL: "+raw+", expected like ws+unix:///path/to.sock:/request/path")
+	}
+}
+
+func TestParseResolve(t *testing.T) {
+	res, err := parseResolve([]string{"example.com:443:127.0.0.1", "example.com:80:[::1]"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"example.com:443": "127.0.0.1:443", "example.com:80": "[::1]:80"}, res)
+	for value, expected := range map[string]string{
+		"example.com:443":           "incorrect resolve value 'example.com:443', expected host:port:addr",
+		"example.com:https:1.2.3.4": "incorrect port in resolve value 'example.com:https:1.2.3.4'",
+		"example.com:443:localhost": "incorrect address in resolve value 'example.com:443:localhost'",
+	} {
+		_, err = parseResolve([]string{value})
+		require.EqualError(t, err, expected)
+	}
+}
+
+func TestNewDialFunc(t *testing.T) {
+	defer func() {
+		netFlags = struct {
+			unixSocket string
+			resolve    []string
+			localAddr  string
+			ipv4       bool
+			ipv6       bool
+		}{}
+	}()
+	dial, err := newDialFunc()
+	require.NoError(t, err)
+	require.Nil(t, dial)
+	netFlags.ipv4, netFlags.ipv6 = true, true
+	_, err = newDialFunc()
+	require.EqualError(t, err, "-4 and -6 can't be used together")
+	netFlags.ipv6 = false
+	netFlags.unixSocket = "/run/app.sock"
+	_, err = newDialFunc()
+	require.EqualError(t, err, "unix socket can't be used with --resolve, --local-addr, -4 or -6")
+	netFlags.unixSocket = ""
+	netFlags.localAddr = "local"
+	_, err = newDialFunc()
+	require.EqualError(t, err, "incorrect local address: local")
+	// IPv4 only connection to IPv6 address
+	netFlags.localAddr = ""
+	dial, err = newDialFunc()
+	require.NoError(t, err)
+	_, err = dial(context.Background(), "tcp", "[::1]:8080")
+	require.ErrorContains(t, err, "address ::1: no suitable address")
+}
+
+func TestDialUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "ws.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	s := server.NewServer("")
+	s.WSHandleFunc("/ws", server.EchoHandler)
+	go s.Serve(listener)
+	defer s.Close()
+	defer func() {
+		netFlags.unixSocket = ""
+		options.netDial = nil
+	}()
+	dest, _ := url.Parse("ws+unix://" + socket + ":/ws")
+	dest, err = unixURL(dest)
+	require.NoError(t, err)
+	options.netDial, err = newDialFunc()
+	require.NoError(t, err)
+	ws, err := (&Session{}).dial(context.Background(), dest.String())
+	require.NoError(t, err)
+	defer ws.Close()
+	require.NoError(t, ws.WriteMessage(websocket.TextMessage, []byte("hello")))
+	_, data, err := ws.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+}
+
+func TestDialResolve(t *testing.T) {
+	newEchoServer(t)
+	netFlags.resolve = []string{"example.invalid:8080:127.0.0.1"}
+	netFlags.localAddr = "127.0.0.1"
+	defer func() {
+		netFlags.resolve = nil
+		netFlags.localAddr = ""
+		options.netDial = nil
+	}()
+	var err error
+	options.netDial, err = newDialFunc()
+	require.NoError(t, err)
+	ws, err := (&Session{}).dial(context.Background(), "ws://example.invalid:8080/ws")
+	require.NoError(t, err)
+	ws.Close()
+}
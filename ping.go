@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pingStats matches the received pongs to the sent pings and collects the round-trip times.
+// The ping payload is 'sequence:unix time in ms'.
+type pingStats struct {
+	lock    sync.Mutex
+	seq     int
+	pending map[int]time.Time
+	sent    int
+	pongs   int
+	lost    int
+	dead    bool
+	rtt     []time.Duration
+}
+
+func newPingStats() *pingStats {
+	return &pingStats{pending: map[int]time.Time{}}
+}
+
+// reset prepares the stats for new connection: pending pings of the previous connection are lost
+func (p *pingStats) reset() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.lost += len(p.pending)
+	p.pending = map[int]time.Time{}
+	p.dead = false
+}
+
+// next registers the new ping and returns its payload
+func (p *pingStats) next() string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.seq++
+	p.sent++
+	now := time.Now()
+	p.pending[p.seq] = now
+	return fmt.Sprintf("%d:%d", p.seq, now.UnixMilli())
+}
+
+// unanswered returns the number of pings of current connection without pong
+func (p *pingStats) unanswered() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return len(p.pending)
+}
+
+// pong matches the pong payload to the sent ping and returns the round-trip time. The pings sent before the matched one are lost.
+func (p *pingStats) pong(payload string) (time.Duration, bool) {
+	seqStr, _, _ := strings.Cut(payload, ":")
+	seq, err := strconv.Atoi(seqStr)
+	if err != nil {
+		return 0, false
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	sent, ok := p.pending[seq]
+	if !ok {
+		return 0, false
+	}
+	rtt := time.Since(sent)
+	for s := range p.pending {
+		if s < seq {
+			p.lost++
+		}
+		if s <= seq {
+			delete(p.pending, s)
+		}
+	}
+	p.pongs++
+	p.rtt = append(p.rtt, rtt)
+	return rtt, true
+}
+
+// markDead marks the current connection as dead
+func (p *pingStats) markDead() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.dead = true
+}
+
+func (p *pingStats) isDead() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.dead
+}
+
+// summary returns the pings statistics. The pending pings sent more than timeout ago are counted as lost.
+func (p *pingStats) summary(timeout time.Duration) string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	lost := p.lost
+	for _, sent := range p.pending {
+		if time.Since(sent) > timeout {
+			lost++
+		}
+	}
+	return fmt.Sprintf("pings: %d sent, %d answered, %d lost, round-trip latency: %s", p.sent, p.pongs, lost, latencySummary(p.rtt))
+}
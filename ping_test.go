@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPingStats(t *testing.T) {
+	p := newPingStats()
+	first := p.next()
+	require.True(t, strings.HasPrefix(first, "1:"))
+	second := p.next()
+	require.Equal(t, 2, p.unanswered())
+	_, matched := p.pong("unknown")
+	require.False(t, matched)
+	rtt, matched := p.pong(second)
+	require.True(t, matched)
+	require.Greater(t, rtt, time.Duration(0))
+	require.Equal(t, 0, p.unanswered())
+	p.next()
+	p.reset()
+	require.Equal(t, 0, p.unanswered())
+	summary := p.summary(time.Second)
+	require.True(t, strings.HasPrefix(summary, "pings: 3 sent, 1 answered, 2 lost, round-trip latency: min "), summary)
+	require.Contains(t, newPingStats().summary(time.Second), "round-trip latency: no data")
+}
+
+func TestPingRTT(t *testing.T) {
+	newEchoServer(t)
+	options.pingInterval = 10 * time.Millisecond
+	options.wait = 55 * time.Millisecond
+	defer func() { options.pingInterval, options.wait = 0, 0 }()
+	s := &Session{}
+	errs := s.batch(mockURL, strings.NewReader(""), &bytes.Buffer{})
+	require.Empty(t, errs)
+	require.NotNil(t, s.pings)
+	require.GreaterOrEqual(t, s.pings.pongs, 3)
+	require.Len(t, s.pings.rtt, s.pings.pongs)
+}
+
+func TestPingDeadConnection(t *testing.T) {
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetPingHandler(func(string) error { return nil }) // pings are not answered
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+	options.pingInterval = 5 * time.Millisecond
+	options.maxMissedPongs = 2
+	options.wait = time.Second
+	defer func() { options.pingInterval, options.maxMissedPongs, options.wait = 0, 0, 0 }()
+	s := &Session{}
+	start := time.Now()
+	errs := s.batch("ws"+strings.TrimPrefix(srv.URL, "http"), strings.NewReader(""), &bytes.Buffer{})
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs[0], "connection is dead: 2 pings are not answered")
+}
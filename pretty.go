@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+var (
+	jsKeySprint     = color.New(color.FgCyan).SprintFunc()
+	jsStringSprint  = color.New(color.FgGreen).SprintFunc()
+	jsNumberSprint  = color.New(color.FgYellow).SprintFunc()
+	jsLiteralSprint = color.New(color.FgMagenta).SprintFunc()
+)
+
+// formatMessage formats the message line for console output: prefix followed by text colored by sprintf.
+// With options.pretty the JSON object or array is indented (continuation lines are aligned with the text start) and highlighted.
+func formatMessage(prefix, text string, sprintf func(format string, a ...interface{}) string) string {
+	if options.pretty {
+		if js, ok := prettyJSON(text, strings.Repeat(" ", len(prefix))); ok {
+			return sprintf("%s", prefix) + js + "\n"
+		}
+	}
+	return sprintf("%s%s\n", prefix, text)
+}
+
+// prettyJSON indents and highlights the JSON object or array. Each new line of result starts with indent.
+// It returns false when text is not a JSON object or array.
+func prettyJSON(text, indent string) (string, bool) {
+	trimmed := strings.TrimSpace(text)
+	if !(strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) {
+		return "", false
+	}
+	buf := &bytes.Buffer{}
+	if err := json.Indent(buf, []byte(trimmed), indent, "  "); err != nil {
+		return "", false
+	}
+	return highlightJSON(buf.String()), true
+}
+
+// highlightJSON colorizes keys, strings, numbers and literals of the valid JSON text
+func highlightJSON(js string) string {
+	res := strings.Builder{}
+	for i := 0; i < len(js); {
+		switch c := js[i]; {
+		case c == '"':
+			end := i + 1
+			for ; end < len(js) && js[end] != '"'; end++ {
+				if js[end] == '\\' {
+					end++
+				}
+			}
+			end++
+			token := js[i:end]
+			if strings.HasPrefix(strings.TrimLeft(js[end:], " \t\r\n"), ":") {
+				res.WriteString(jsKeySprint(token))
+			} else {
+				res.WriteString(jsStringSprint(token))
+			}
+			i = end
+		case c == '-' || c >= '0' && c <= '9':
+			end := i + 1
+			for ; end < len(js) && strings.IndexByte("0123456789+-.eE", js[end]) >= 0; end++ {
+			}
+			res.WriteString(jsNumberSprint(js[i:end]))
+			i = end
+		case c == 't' || c == 'f' || c == 'n':
+			end := i + 1
+			for ; end < len(js) && js[end] >= 'a' && js[end] <= 'z'; end++ {
+			}
+			res.WriteString(jsLiteralSprint(js[i:end]))
+			i = end
+		default:
+			res.WriteByte(c)
+			i++
+		}
+	}
+	return res.String()
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrettyJSON(t *testing.T) {
+	js, ok := prettyJSON(` {"a":1,"b":["x",true,null],"c":{}} `, "    ")
+	require.True(t, ok)
+	require.Equal(t, "{\n      \"a\": 1,\n      \"b\": [\n        \"x\",\n        true,\n        null\n      ],\n      \"c\": {}\n    }", js)
+	for _, text := range []string{"plain text", "42", `"string"`, `{"broken":`, ""} {
+		_, ok = prettyJSON(text, "")
+		require.False(t, ok, text)
+	}
+}
+
+func TestHighlightJSON(t *testing.T) {
+	noColor := color.NoColor
+	color.NoColor = false
+	defer func() { color.NoColor = noColor }()
+	res := highlightJSON(`{"k\"ey" : "v:al", "n": -1.5e3, "t": false}`)
+	require.Equal(t, "{"+jsKeySprint(`"k\"ey"`)+" : "+jsStringSprint(`"v:al"`)+", "+jsKeySprint(`"n"`)+": "+jsNumberSprint("-1.5e3")+", "+jsKeySprint(`"t"`)+": "+jsLiteralSprint("false")+"}", res)
+	require.Contains(t, res, "\x1b[36m\"n\"\x1b[0m")
+}
+
+func TestFormatMessage(t *testing.T) {
+	require.Equal(t, "< {\"a\":1}\n", formatMessage("< ", `{"a":1}`, rxSprintf))
+	options.pretty = true
+	defer func() { options.pretty = false }()
+	require.Equal(t, "< {\n    \"a\": 1\n  }\n", formatMessage("< ", `{"a":1}`, rxSprintf))
+	require.Equal(t, "> not json\n", formatMessage("> ", "not json", txSprintf))
+}
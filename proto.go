@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// protoFlags are raw protobuf options
+var protoFlags struct {
+	descriptor string
+	msgType    string
+}
+
+// protoCodec converts the protobuf messages of one type to JSON and back
+type protoCodec struct {
+	desc protoreflect.MessageDescriptor
+}
+
+// loadProto makes the protoCodec from protoFlags. It returns nil when protobuf options are not set.
+// The descriptor file is the FileDescriptorSet made by 'protoc --include_imports --descriptor_set_out=file.pb'.
+func loadProto() (*protoCodec, error) {
+	if protoFlags.descriptor == "" && protoFlags.msgType == "" {
+		return nil, nil
+	}
+	if protoFlags.descriptor == "" || protoFlags.msgType == "" {
+		return nil, errors.New("--proto-descriptor and --proto-type should be used together")
+	}
+	data, err := os.ReadFile(protoFlags.descriptor)
+	if err != nil {
+		return nil, fmt.Errorf("proto descriptor reading error: %w", err)
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err = proto.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("incorrect proto descriptor %s: %w", protoFlags.descriptor, err)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("incorrect proto descriptor %s: %w", protoFlags.descriptor, err)
+	}
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(protoFlags.msgType))
+	if err != nil {
+		return nil, fmt.Errorf("proto type '%s' is not found in %s", protoFlags.msgType, protoFlags.descriptor)
+	}
+	msgDesc, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("'%s' is not a message type", protoFlags.msgType)
+	}
+	return &protoCodec{desc: msgDesc}, nil
+}
+
+// decode converts the protobuf message to compact JSON
+func (c *protoCodec) decode(data []byte) (string, error) {
+	msg := dynamicpb.NewMessage(c.desc)
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return "", err
+	}
+	if len(msg.GetUnknown()) > 0 { // most likely the message is of other type
+		return "", fmt.Errorf("message is not %s", c.desc.FullName())
+	}
+	text, err := protojson.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	if err = json.Compact(buf, text); err != nil { // protojson output has unstable spaces
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// encode converts the JSON text to protobuf message
+func (c *protoCodec) encode(text string) ([]byte, error) {
+	msg := dynamicpb.NewMessage(c.desc)
+	if err := protojson.Unmarshal([]byte(text), msg); err != nil {
+		return nil, fmt.Errorf("encoding to %s error: %w", c.desc.FullName(), err)
+	}
+	return proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// writeTestDescriptor writes the descriptor set with message 'test.Trade {string symbol = 1; double price = 2;}'
+func writeTestDescriptor(t *testing.T) string {
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String("trade.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Trade"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("symbol"), JsonName: proto.String("symbol"), Number: proto.Int32(1),
+					Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+				{Name: proto.String("price"), JsonName: proto.String("price"), Number: proto.Int32(2),
+					Type: descriptorpb.FieldDescriptorProto_TYPE_DOUBLE.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+			},
+		}},
+	}}}
+	data, err := proto.Marshal(set)
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "trade.pb")
+	require.NoError(t, os.WriteFile(file, data, 0o600))
+	return file
+}
+
+func TestLoadProto(t *testing.T) {
+	defer func() { protoFlags.descriptor, protoFlags.msgType = "", "" }()
+	codec, err := loadProto()
+	require.NoError(t, err)
+	require.Nil(t, codec)
+	protoFlags.msgType = "test.Trade"
+	_, err = loadProto()
+	require.EqualError(t, err, "--proto-descriptor and --proto-type should be used together")
+	protoFlags.descriptor = writeTestDescriptor(t)
+	codec, err = loadProto()
+	require.NoError(t, err)
+	require.Equal(t, "test.Trade", string(codec.desc.FullName()))
+	protoFlags.msgType = "test.Order"
+	_, err = loadProto()
+	require.EqualError(t, err, "proto type 'test.Order' is not found in "+protoFlags.descriptor)
+	protoFlags.msgType = "test.Trade.symbol"
+	_, err = loadProto()
+	require.EqualError(t, err, "'test.Trade.symbol' is not a message type")
+	protoFlags.descriptor = filepath.Join(t.TempDir(), "missing.pb")
+	_, err = loadProto()
+	require.ErrorContains(t, err, "proto descriptor reading error: ")
+}
+
+func TestProtoCodec(t *testing.T) {
+	protoFlags.descriptor, protoFlags.msgType = writeTestDescriptor(t), "test.Trade"
+	defer func() { protoFlags.descriptor, protoFlags.msgType = "", "" }()
+	codec, err := loadProto()
+	require.NoError(t, err)
+	data, err := codec.encode(`{"symbol": "BTC", "price": 64000.5}`)
+	require.NoError(t, err)
+	text, err := codec.decode(data)
+	require.NoError(t, err)
+	require.Equal(t, `{"symbol":"BTC","price":64000.5}`, text)
+	_, err = codec.encode(`{"volume": 1}`)
+	require.ErrorContains(t, err, "encoding to test.Trade error: ")
+	_, err = codec.decode([]byte{0xff, 0xff})
+	require.Error(t, err)
+	_, err = codec.decode([]byte{0x18, 0x01}) // field 3 is unknown
+	require.EqualError(t, err, "message is not test.Trade")
+
+	_, ok := decodeMessage(data)
+	require.False(t, ok)
+	options.proto = codec
+	defer func() { options.proto, options.decoders = nil, nil }()
+	options.decoders, err = compileDecoders("proto")
+	require.NoError(t, err)
+	text, ok = decodeMessage(data)
+	require.True(t, ok)
+	require.Equal(t, `{"symbol":"BTC","price":64000.5}`, text)
+	msgType, encoded, err := lineMessage(`{"symbol": "BTC", "price": 64000.5}`)
+	require.NoError(t, err)
+	require.Equal(t, websocket.BinaryMessage, msgType)
+	require.Equal(t, data, encoded)
+	_, _, err = lineMessage("not JSON")
+	require.Error(t, err)
+	options.initMsg = `{"symbol": "BTC", "price": 64000.5}`
+	defer func() { options.initMsg = "" }()
+	msgType, encoded, err = initMessage()
+	require.NoError(t, err)
+	require.Equal(t, websocket.BinaryMessage, msgType)
+	require.Equal(t, data, encoded)
+	options.initMsg = "not JSON"
+	_, _, err = initMessage()
+	require.ErrorContains(t, err, "encoding to test.Trade error: ")
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// proxyFlags are raw proxy options
+var proxyFlags struct {
+	proxy   string
+	noProxy string
+}
+
+// proxyFunc returns the proxy URL for the request or nil when the request should be made directly
+type proxyFunc func(*http.Request) (*url.URL, error)
+
+// newProxyFunc makes the proxyFunc from proxyFlags. Without --proxy the proxy is taken from environment (HTTP_PROXY, HTTPS_PROXY and NO_PROXY).
+// The hosts from --noproxy are connected directly in both cases.
+func newProxyFunc() (proxyFunc, error) {
+	proxy := http.ProxyFromEnvironment
+	if proxyFlags.proxy != "" {
+		proxyURL, err := url.Parse(proxyFlags.proxy)
+		if err != nil {
+			return nil, fmt.Errorf("incorrect proxy URL: %w", err)
+		}
+		if proxyURL.Scheme != "http" && proxyURL.Scheme != "socks5" {
+			return nil, fmt.Errorf("unsupported proxy scheme '%s', use http or socks5", proxyURL.Scheme)
+		}
+		if proxyURL.Hostname() == "" {
+			return nil, fmt.Errorf("no host in proxy URL: %s", proxyURL.Redacted())
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+	noProxy := []string{}
+	for _, host := range strings.Split(proxyFlags.noProxy, ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			noProxy = append(noProxy, host)
+		}
+	}
+	if len(noProxy) == 0 {
+		return proxy, nil
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		if bypassProxy(noProxy, req.URL) {
+			return nil, nil
+		}
+		return proxy(req)
+	}, nil
+}
+
+// bypassProxy reports whether the URL host matches any of noProxy entries: '*', host, domain (with subdomains), IP, CIDR or host:port
+func bypassProxy(noProxy []string, dest *url.URL) bool {
+	host, port := strings.ToLower(dest.Hostname()), dest.Port()
+	if port == "" {
+		port = "80"
+		if dest.Scheme == "https" || dest.Scheme == "wss" {
+			port = "443"
+		}
+	}
+	ip := net.ParseIP(host)
+	for _, entry := range noProxy {
+		if entry == "*" {
+			return true
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		entryHost, entryPort, err := net.SplitHostPort(entry)
+		if err != nil {
+			entryHost, entryPort = strings.Trim(entry, "[]"), ""
+		}
+		if entryPort != "" && entryPort != port {
+			continue
+		}
+		domain := strings.TrimPrefix(entryHost, ".")
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyTracker chooses the proxy for request and remembers it
+type proxyTracker struct {
+	proxy proxyFunc
+	used  *url.URL
+}
+
+// choose returns the proxy for request. Without proxy function the proxy is taken from environment.
+func (t *proxyTracker) choose(req *http.Request) (*url.URL, error) {
+	proxy := t.proxy
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
+	u, err := proxy(req)
+	t.used = u
+	return u, err
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBypassProxy(t *testing.T) {
+	noProxy := []string{"example.com", ".internal", "10.0.0.0/8", "api.test:8443", "[::1]"}
+	for raw, expected := range map[string]bool{
+		"ws://example.com/ws":       true,
+		"ws://www.example.com/ws":   true,
+		"ws://notexample.com/ws":    false,
+		"wss://svc.internal/ws":     true,
+		"ws://10.1.2.3:8080/ws":     true,
+		"ws://11.1.2.3:8080/ws":     false,
+		"wss://api.test:8443/ws":    true,
+		"wss://api.test/ws":         false,
+		"ws://[::1]:8080/ws":        true,
+		"ws://EXAMPLE.com:8080/ws":  true,
+		"https://example.org/ws":    false,
+		"http://sub.api.test:8443/": true,
+	} {
+		dest, _ := url.Parse(raw)
+		require.Equal(t, expected, bypassProxy(noProxy, dest), raw)
+	}
+	dest, _ := url.Parse("ws://any.host/ws")
+	require.True(t, bypassProxy([]string{"*"}, dest))
+}
+
+func TestNewProxyFunc(t *testing.T) {
+	defer func() {
+		proxyFlags.proxy = ""
+		proxyFlags.noProxy = ""
+	}()
+	for value, expected := range map[string]string{
+		"ftp://proxy:21":  "unsupported proxy scheme 'ftp', use http or socks5",
+		"http://:pass@/":  "no host in proxy URL: http://:xxxxx@/",
+		"http://proxy:%1": `incorrect proxy URL: parse "http://proxy:%1": invalid port ":%1" after host`,
+	} {
+		proxyFlags.proxy = value
+		_, err := newProxyFunc()
+		require.EqualError(t, err, expected, value)
+	}
+	proxyFlags.proxy = "socks5://proxy:1080"
+	proxyFlags.noProxy = " localhost, ,127.0.0.1 "
+	proxy, err := newProxyFunc()
+	require.NoError(t, err)
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/ws", nil)
+	u, err := proxy(req)
+	require.NoError(t, err)
+	require.Equal(t, "socks5://proxy:1080", u.String())
+	req, _ = http.NewRequest(http.MethodGet, "http://localhost:8080/ws", nil)
+	u, err = proxy(req)
+	require.NoError(t, err)
+	require.Nil(t, u)
+}
+
+// newConnectProxy starts HTTP CONNECT proxy that requires basic authorization
+func newConnectProxy(t *testing.T, user, password string) (*httptest.Server, *[]string) {
+	connected := &[]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+		if r.Method != http.MethodConnect || r.Header.Get("Proxy-Authorization") != auth {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		*connected = append(*connected, r.Host)
+		w.WriteHeader(http.StatusOK)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			target.Close()
+			return
+		}
+		go func() {
+			io.Copy(target, conn)
+			target.Close()
+		}()
+		go func() {
+			io.Copy(conn, target)
+			conn.Close()
+		}()
+	}))
+	t.Cleanup(srv.Close)
+	return srv, connected
+}
+
+func TestDialProxy(t *testing.T) {
+	newEchoServer(t)
+	srv, connected := newConnectProxy(t, "user", "secret")
+	defer func() {
+		proxyFlags.proxy = ""
+		options.proxy = nil
+	}()
+	host := strings.TrimPrefix(srv.URL, "http://")
+	proxyFlags.proxy = "http://user:secret@" + host
+	var err error
+	options.proxy, err = newProxyFunc()
+	require.NoError(t, err)
+	ws, err := (&Session{}).dial(context.Background(), mockURL)
+	require.NoError(t, err)
+	ws.Close()
+	require.Equal(t, []string{"localhost:8080"}, *connected)
+	proxyFlags.proxy = "http://user:wrong@" + host
+	options.proxy, err = newProxyFunc()
+	require.NoError(t, err)
+	_, err = (&Session{}).dial(context.Background(), mockURL)
+	require.EqualError(t, err, "Proxy Authentication Required (via proxy http://user:xxxxx@"+host+")")
+}
@@ -0,0 +1,522 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// query is the compiled jq-like expression evaluated over decoded JSON message.
+// Supported syntax:
+//
+//	.                         the whole message
+//	.field.sub[0]["key"]      path to the value, missing values are null
+//	"str" 12.5 true false null literals
+//	== != > >= < <=           comparisons (ordering is defined for numbers and strings only)
+//	=~ "regexp"               regexp matching of string value
+//	&& || ! ( )               logical operators and grouping
+type query struct {
+	src  string
+	root node
+}
+
+// node is the evaluable element of query
+type node func(v any) any
+
+// compileQuery compiles the single expression
+func compileQuery(src string) (*query, error) {
+	p, err := newParser(src)
+	if err != nil {
+		return nil, err
+	}
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.end() {
+		return nil, fmt.Errorf("query '%s': unexpected '%s'", src, p.peek().text)
+	}
+	return &query{src: src, root: root}, nil
+}
+
+// compileQueryList compiles comma separated list of expressions
+func compileQueryList(src string) ([]*query, error) {
+	p, err := newParser(src)
+	if err != nil {
+		return nil, err
+	}
+	res := []*query{}
+	for {
+		start := p.pos
+		root, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, &query{src: p.source(start, p.pos), root: root})
+		if p.end() {
+			return res, nil
+		}
+		if p.peek().text != "," {
+			return nil, fmt.Errorf("query '%s': unexpected '%s'", src, p.peek().text)
+		}
+		p.next()
+	}
+}
+
+// eval returns the query result for the decoded JSON value
+func (q *query) eval(v any) any {
+	return q.root(v)
+}
+
+// match reports whether the query result is truthy (not null and not false)
+func (q *query) match(v any) bool {
+	return truthy(q.eval(v))
+}
+
+// selectMessage applies options.selector and options.extract to the message text. It returns false when message is not selected.
+// When message is not a JSON it is selected only if there is no selector, the extraction is not applied for it.
+func selectMessage(text string) (string, bool) {
+	if options.selector == nil && options.extract == nil {
+		return text, true
+	}
+	v, ok := decodeJSON(text)
+	if !ok {
+		return text, options.selector == nil
+	}
+	if options.selector != nil && !options.selector.match(v) {
+		return "", false
+	}
+	if options.extract != nil {
+		values := make([]string, len(options.extract))
+		for i, q := range options.extract {
+			values[i] = formatValue(q.eval(v))
+		}
+		text = strings.Join(values, " ")
+	}
+	return text, true
+}
+
+// matcher matches the message text by regexp or by JSON predicate
+type matcher struct {
+	re *regexp.Regexp
+	q  *query
+}
+
+// compileMatcher compiles expression as JSON predicate when it starts with unambiguous query token ('!' or '.' followed by field),
+// otherwise as regexp. The expression started with '(' is tried as JSON predicate and then as regexp.
+func compileMatcher(expr string) (*matcher, error) {
+	trimmed := strings.TrimSpace(expr)
+	if isQuery(trimmed) {
+		q, err := compileQuery(expr)
+		if err != nil {
+			return nil, err
+		}
+		return &matcher{q: q}, nil
+	}
+	var queryErr error
+	if strings.HasPrefix(trimmed, "(") {
+		q, err := compileQuery(expr)
+		if err == nil {
+			return &matcher{q: q}, nil
+		}
+		queryErr = err
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		if queryErr != nil {
+			return nil, fmt.Errorf("%v; compiling regexp '%s' error: %w", queryErr, expr, err)
+		}
+		return nil, fmt.Errorf("compiling regexp '%s' error: %w", expr, err)
+	}
+	return &matcher{re: re}, nil
+}
+
+// isQuery reports whether the expression starts with unambiguous query token: '!' or '.' followed by field name, '[' or '"'
+func isQuery(expr string) bool {
+	if strings.HasPrefix(expr, "!") {
+		return true
+	}
+	if len(expr) < 2 || expr[0] != '.' {
+		return false
+	}
+	c := expr[1]
+	return c == '_' || c == '[' || c == '"' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// match reports whether text matches regexp or it is JSON that matches predicate
+func (m *matcher) match(text string) bool {
+	if m.re != nil {
+		return m.re.MatchString(text)
+	}
+	v, ok := decodeJSON(text)
+	return ok && m.q.match(v)
+}
+
+// decodeJSON decodes the message text, it returns false when the text is not a valid JSON.
+// The numbers are decoded as json.Number to keep the precision of big integers (like IDs).
+func decodeJSON(text string) (any, bool) {
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, false
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, false
+	}
+	return v, true
+}
+
+// formatValue formats the query result for printing: strings are printed as is, other values as JSON
+func formatValue(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	res, _ := json.Marshal(v)
+	return string(res)
+}
+
+func truthy(v any) bool {
+	return v != nil && v != false
+}
+
+// token kinds
+const (
+	tkPunct = iota
+	tkIdent
+	tkString
+	tkNumber
+	tkEnd
+)
+
+type token struct {
+	kind  int
+	text  string
+	value any
+	pos   int
+}
+
+type parser struct {
+	src    string
+	tokens []token
+	pos    int
+}
+
+var punctuation = []string{"==", "!=", ">=", "<=", "=~", "&&", "||", ">", "<", "!", "(", ")", "[", "]", ".", ","}
+
+func newParser(src string) (*parser, error) {
+	p := &parser{src: src}
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"':
+			end := i + 1
+			for ; end < len(src) && src[end] != '"'; end++ {
+				if src[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(src) {
+				return nil, fmt.Errorf("query '%s': unterminated string", src)
+			}
+			var str string
+			if err := json.Unmarshal([]byte(src[i:end+1]), &str); err != nil {
+				return nil, fmt.Errorf("query '%s': incorrect string %s", src, src[i:end+1])
+			}
+			p.tokens = append(p.tokens, token{tkString, src[i : end+1], str, i})
+			i = end + 1
+		case c == '-' || c >= '0' && c <= '9':
+			end := i + 1
+			for ; end < len(src) && strings.IndexByte("0123456789.eE+-", src[end]) >= 0; end++ {
+			}
+			if _, ok := new(big.Rat).SetString(src[i:end]); !ok {
+				return nil, fmt.Errorf("query '%s': incorrect number %s", src, src[i:end])
+			}
+			p.tokens = append(p.tokens, token{tkNumber, src[i:end], json.Number(src[i:end]), i})
+			i = end
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			end := i + 1
+			for ; end < len(src) && (src[end] == '_' || src[end] >= 'a' && src[end] <= 'z' || src[end] >= 'A' && src[end] <= 'Z' || src[end] >= '0' && src[end] <= '9'); end++ {
+			}
+			p.tokens = append(p.tokens, token{tkIdent, src[i:end], nil, i})
+			i = end
+		default:
+			found := false
+			for _, punct := range punctuation {
+				if strings.HasPrefix(src[i:], punct) {
+					p.tokens = append(p.tokens, token{tkPunct, punct, nil, i})
+					i += len(punct)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("query '%s': unexpected character '%c'", src, c)
+			}
+		}
+	}
+	p.tokens = append(p.tokens, token{tkEnd, "end of query", nil, len(src)})
+	return p, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tkEnd {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) end() bool {
+	return p.peek().kind == tkEnd
+}
+
+// source returns the query text of tokens from start till end (exclusive)
+func (p *parser) source(start, end int) string {
+	return strings.TrimSpace(p.src[p.tokens[start].pos:p.tokens[end].pos])
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("query '%s': %s", p.src, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) parseExpr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().text == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(v any) any { return truthy(l(v)) || truthy(right(v)) }
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().text == "&&" {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(v any) any { return truthy(l(v)) && truthy(right(v)) }
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.peek().text == "!" && p.peek().kind == tkPunct {
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(v any) any { return !truthy(operand(v)) }, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	op := p.peek()
+	if op.kind != tkPunct {
+		return left, nil
+	}
+	switch op.text {
+	case "=~":
+		p.next()
+		t := p.next()
+		if t.kind != tkString {
+			return nil, p.errorf("regexp string expected after =~")
+		}
+		re, err := regexp.Compile(t.value.(string))
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		return func(v any) any {
+			s, ok := left(v).(string)
+			return ok && re.MatchString(s)
+		}, nil
+	case "==", "!=", ">", ">=", "<", "<=":
+		p.next()
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return func(v any) any { return compare(op.text, left(v), right(v)) }, nil
+	}
+	return left, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tkString, tkNumber:
+		return func(any) any { return t.value }, nil
+	case tkIdent:
+		switch t.text {
+		case "true":
+			return func(any) any { return true }, nil
+		case "false":
+			return func(any) any { return false }, nil
+		case "null":
+			return func(any) any { return nil }, nil
+		}
+		return nil, p.errorf("unexpected '%s'", t.text)
+	case tkPunct:
+		switch t.text {
+		case "(":
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if p.next().text != ")" {
+				return nil, p.errorf("')' expected")
+			}
+			return expr, nil
+		case ".":
+			return p.parsePath()
+		}
+	}
+	return nil, p.errorf("unexpected '%s'", t.text)
+}
+
+// parsePath parses the path after the leading dot
+func (p *parser) parsePath() (node, error) {
+	steps := []func(any) any{}
+	if t := p.peek(); t.kind == tkIdent || t.kind == tkString {
+		steps = append(steps, field(p.next()))
+	}
+	for {
+		switch p.peek().text {
+		case ".":
+			p.next()
+			t := p.next()
+			if t.kind != tkIdent && t.kind != tkString {
+				return nil, p.errorf("field name expected after '.'")
+			}
+			steps = append(steps, field(t))
+		case "[":
+			p.next()
+			t := p.next()
+			switch t.kind {
+			case tkString:
+				steps = append(steps, field(t))
+			case tkNumber:
+				idx64, err := t.value.(json.Number).Int64()
+				if err != nil {
+					return nil, p.errorf("integer index expected instead of %s", t.text)
+				}
+				idx := int(idx64)
+				steps = append(steps, func(v any) any {
+					arr, ok := v.([]any)
+					if !ok {
+						return nil
+					}
+					i := idx
+					if i < 0 {
+						i += len(arr)
+					}
+					if i < 0 || i >= len(arr) {
+						return nil
+					}
+					return arr[i]
+				})
+			default:
+				return nil, p.errorf("index or key expected after '['")
+			}
+			if p.next().text != "]" {
+				return nil, p.errorf("']' expected")
+			}
+		default:
+			return func(v any) any {
+				for _, step := range steps {
+					v = step(v)
+				}
+				return v
+			}, nil
+		}
+	}
+}
+
+func field(t token) func(any) any {
+	name := t.text
+	if t.kind == tkString {
+		name = t.value.(string)
+	}
+	return func(v any) any {
+		if obj, ok := v.(map[string]any); ok {
+			return obj[name]
+		}
+		return nil
+	}
+}
+
+// number converts the JSON number to exact rational value
+func number(v any) (*big.Rat, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return nil, false
+	}
+	return new(big.Rat).SetString(string(n))
+}
+
+// compare applies the comparison operator. The numbers are compared exactly, ordering is defined for numbers and strings only.
+func compare(op string, a, b any) bool {
+	x, xNum := number(a)
+	y, yNum := number(b)
+	var res int
+	switch {
+	case xNum && yNum:
+		res = x.Cmp(y)
+	case op == "==":
+		return reflect.DeepEqual(a, b)
+	case op == "!=":
+		return !reflect.DeepEqual(a, b)
+	default:
+		xStr, ok := a.(string)
+		yStr, ok2 := b.(string)
+		if !ok || !ok2 {
+			return false
+		}
+		res = cmp.Compare(xStr, yStr)
+	}
+	switch op {
+	case "==":
+		return res == 0
+	case "!=":
+		return res != 0
+	case ">":
+		return res > 0
+	case ">=":
+		return res >= 0
+	case "<":
+		return res < 0
+	default:
+		return res <= 0
+	}
+}
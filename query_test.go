@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuery(t *testing.T) {
+	msg, ok := decodeJSON(`{"type":"trade","price":120.5,"tags":["a","b"],"meta":{"odd key":true,"n":null},"name":"BTC-USD"}`)
+	require.True(t, ok)
+	testCases := []struct {
+		query string
+		match bool
+	}{
+		{`.type == "trade"`, true},
+		{`.type == "trade" && .price > 100`, true},
+		{`.type == "trade" && .price > 200`, false},
+		{`.type != "trade" || .price <= 120.5`, true},
+		{`!(.price < 100)`, true},
+		{`.tags[0] == "a" && .tags[-1] == "b" && .tags[2] == null`, true},
+		{`.meta["odd key"]`, true},
+		{`.meta.n`, false},
+		{`.missing.deep[3]`, false},
+		{`.name =~ "^BTC-"`, true},
+		{`.price =~ "1"`, false},
+		{`.name > "A" && .name < "C"`, true},
+		{`.price > "100"`, false},
+		{`.tags == .tags`, true},
+		{`.`, true},
+		{`.meta.odd`, false},
+		{`.price == 120.50`, true},
+		{`.price >= 1.205e2`, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			q, err := compileQuery(tc.query)
+			require.NoError(t, err)
+			require.Equal(t, tc.match, q.match(msg))
+		})
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	testCases := map[string]string{
+		`.a ==`:       `query '.a ==': unexpected 'end of query'`,
+		`.a == "b`:    `query '.a == "b': unterminated string`,
+		`.a @ 1`:      `query '.a @ 1': unexpected character '@'`,
+		`.a "b"`:      `query '.a "b"': unexpected '"b"'`,
+		`(.a`:         `query '(.a': ')' expected`,
+		`.a[`:         `query '.a[': index or key expected after '['`,
+		`.a[1`:        `query '.a[1': ']' expected`,
+		`.a.`:         `query '.a.': field name expected after '.'`,
+		`.a =~ 1`:     `query '.a =~ 1': regexp string expected after =~`,
+		`.a =~ "(("`:  "query '.a =~ \"((\"': error parsing regexp: missing closing ): `((`",
+		`type`:        `query 'type': unexpected 'type'`,
+		`.a == 1.2.3`: `query '.a == 1.2.3': incorrect number 1.2.3`,
+		`.a == "\q"`:  `query '.a == "\q"': incorrect string "\q"`,
+		`.a == 1, .b`: `query '.a == 1, .b': unexpected ','`,
+		`.a[1.5]`:     `query '.a[1.5]': integer index expected instead of 1.5`,
+		`.a && && .b`: `query '.a && && .b': unexpected '&&'`,
+	}
+	for query, expected := range testCases {
+		_, err := compileQuery(query)
+		require.EqualError(t, err, expected, query)
+	}
+	_, err := compileQueryList(`.a "b"`)
+	require.EqualError(t, err, `query '.a "b"': unexpected '"b"'`)
+}
+
+func TestSelectMessage(t *testing.T) {
+	defer func() {
+		options.selector = nil
+		options.extract = nil
+	}()
+	text, ok := selectMessage("any text")
+	require.True(t, ok)
+	require.Equal(t, "any text", text)
+	var err error
+	options.extract, err = compileQueryList(`.name, .price, .tags, .missing`)
+	require.NoError(t, err)
+	require.Len(t, options.extract, 4)
+	require.Equal(t, ".tags", options.extract[2].src)
+	text, ok = selectMessage(`{"name":"BTC","price":1.5,"tags":["x"]}`)
+	require.True(t, ok)
+	require.Equal(t, `BTC 1.5 ["x"] null`, text)
+	text, ok = selectMessage("not json")
+	require.True(t, ok)
+	require.Equal(t, "not json", text)
+	options.selector, err = compileQuery(`.price > 1`)
+	require.NoError(t, err)
+	_, ok = selectMessage("not json")
+	require.False(t, ok)
+	_, ok = selectMessage(`{"price":0.5}`)
+	require.False(t, ok)
+	text, ok = selectMessage(`{"name":"ETH","price":2}`)
+	require.True(t, ok)
+	require.Equal(t, "ETH 2 null null", text)
+	// big integer IDs keep precision
+	options.selector, err = compileQuery(`.id == 12345678901234567890`)
+	require.NoError(t, err)
+	options.extract, err = compileQueryList(`.id`)
+	require.NoError(t, err)
+	_, ok = selectMessage(`{"id":12345678901234567891}`)
+	require.False(t, ok)
+	text, ok = selectMessage(`{"id":12345678901234567890}`)
+	require.True(t, ok)
+	require.Equal(t, "12345678901234567890", text)
+}
+
+func TestDecodeJSON(t *testing.T) {
+	_, ok := decodeJSON(`{"a":1} {"b":2}`)
+	require.False(t, ok)
+	_, ok = decodeJSON(`{"a":1`)
+	require.False(t, ok)
+	v, ok := decodeJSON(` {"a":1} `)
+	require.True(t, ok)
+	require.Equal(t, map[string]any{"a": json.Number("1")}, v)
+}
+
+func TestMatcher(t *testing.T) {
+	testCases := []struct {
+		expr  string
+		text  string
+		match bool
+	}{
+		{`.status == "done"`, `{"status":"done"}`, true},
+		{`.status == "done"`, `{"status":"pending"}`, false},
+		{`.status == "done"`, `status == "done"`, false},
+		{`!.error`, `{"ok":true}`, true},
+		{`done$`, `job is done`, true},
+		{`done$`, `done job`, false},
+		{`.*ready`, `server is ready`, true},
+		{`(?:a|b)c`, `bc`, true},
+		{`(?i)DONE`, `done`, true},
+		{`(done|ready)`, `server is ready`, true},
+		{`(a|b)c`, `bc`, true},
+		{`(.status == "done")`, `{"status":"done"}`, true},
+		{`(.status == "done")`, `(.status == "done")`, false},
+		{`.`, `any`, true},
+	}
+	for _, tc := range testCases {
+		m, err := compileMatcher(tc.expr)
+		require.NoError(t, err)
+		require.Equal(t, tc.match, m.match(tc.text), tc.expr+" : "+tc.text)
+	}
+	_, err := compileMatcher(`[`)
+	require.EqualError(t, err, "compiling regexp '[' error: error parsing regexp: missing closing ]: `[`")
+	_, err = compileMatcher(`(`)
+	require.EqualError(t, err, "query '(': unexpected 'end of query'; compiling regexp '(' error: error parsing regexp: missing closing ): `(`")
+	_, err = compileMatcher(`.status = "done"`)
+	require.EqualError(t, err, "query '.status = \"done\"': unexpected character '='")
+}
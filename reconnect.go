@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// backoff returns the delay before the reconnection attempt (attempts are counted from 1).
+// The delay starts from options.backoffInit, doubles on each attempt up to options.backoffMax
+// and then it is randomly spread by options.backoffJitter fraction (but it never exceeds options.backoffMax).
+func backoff(attempt int) time.Duration {
+	delay := options.backoffInit
+	for i := 1; i < attempt && delay < options.backoffMax; i++ {
+		delay *= 2
+	}
+	delay = min(delay, options.backoffMax)
+	if options.backoffJitter > 0 {
+		delay += time.Duration((rand.Float64()*2 - 1) * options.backoffJitter * float64(delay))
+	}
+	return min(delay, options.backoffMax)
+}
+
+// reconnect re-dials url until success, context cancellation or exceeding the options.maxAttempts
+func (s *Session) reconnect(ctx context.Context, url string) (*websocket.Conn, error) {
+	for attempt := 1; ; attempt++ {
+		delay := backoff(attempt)
+		fmt.Fprint(s.output(), ctSprintf("%sreconnecting in %s (attempt %d)...\n", s.getPrefix(), delay.Round(time.Millisecond), attempt))
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		ws, err := s.dial(ctx, url)
+		if err == nil {
+			fmt.Fprint(s.output(), ctSprintf("%s--- reconnected after %d attempts ---\n", s.getPrefix(), attempt))
+			return ws, nil
+		}
+		if options.maxAttempts > 0 && attempt >= options.maxAttempts {
+			return nil, fmt.Errorf("reconnection failed after %d attempts: %w", attempt, err)
+		}
+		fmt.Fprint(s.output(), ctSprintf("%sreconnection error: %v\n", s.getPrefix(), err))
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/chzyer/readline"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoff(t *testing.T) {
+	options.backoffInit = 100 * time.Millisecond
+	options.backoffMax = time.Second
+	defer func() {
+		options.backoffInit = 0
+		options.backoffMax = 0
+		options.backoffJitter = 0
+	}()
+	require.Equal(t, 100*time.Millisecond, backoff(1))
+	require.Equal(t, 200*time.Millisecond, backoff(2))
+	require.Equal(t, 800*time.Millisecond, backoff(4))
+	require.Equal(t, time.Second, backoff(5))
+	require.Equal(t, time.Second, backoff(100))
+	options.backoffJitter = 0.5
+	for range 100 {
+		d := backoff(2)
+		require.GreaterOrEqual(t, d, 100*time.Millisecond)
+		require.LessOrEqual(t, d, 300*time.Millisecond)
+	}
+	for range 100 {
+		require.LessOrEqual(t, backoff(100), time.Second)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	srv := newMockServer(0)
+	options.reconnect = true
+	options.backoffInit = 10 * time.Millisecond
+	options.backoffMax = 20 * time.Millisecond
+	options.initMsg = "init"
+	outR, outW, _ := os.Pipe()
+	inR, inW, _ := os.Pipe()
+	defer func() {
+		inW.Close()
+		outW.Close()
+		options.reconnect = false
+		options.backoffInit = 0
+		options.backoffMax = 0
+		options.initMsg = ""
+	}()
+	rl, err := readline.NewEx(&readline.Config{Prompt: "> ", Stdin: inR, Stdout: outW, FuncMakeRaw: success, FuncExitRaw: success})
+	require.NoError(t, err)
+	s := &Session{rl: rl}
+	errs := make(chan []error, 1)
+	go func() {
+		errs <- s.connect(mockURL)
+	}()
+	require.Eventually(t, func() bool { return len(srv.Received) > 0 }, 100*time.Millisecond, 2*time.Millisecond)
+	require.Equal(t, "init", <-srv.Received)
+	srv.Close()
+	time.Sleep(50 * time.Millisecond) // let client to fail some reconnection attempts
+	srv = newMockServer(0)
+	defer srv.Close()
+	require.Eventually(t, func() bool { return len(srv.Received) > 0 }, 200*time.Millisecond, 2*time.Millisecond)
+	require.Equal(t, "init", <-srv.Received)
+	s.cancel()
+	inW.Close()
+	require.Empty(t, <-errs)
+	outW.Close()
+	output, err := io.ReadAll(outR)
+	require.NoError(t, err)
+	out := string(output)
+	require.Contains(t, out, "reconnection error:")
+	require.Contains(t, out, "--- reconnected after ")
+}
+
+func TestReconnectMaxAttempts(t *testing.T) {
+	options.backoffInit = time.Millisecond
+	options.backoffMax = time.Millisecond
+	options.maxAttempts = 2
+	defer func() {
+		options.backoffInit = 0
+		options.backoffMax = 0
+		options.maxAttempts = 0
+	}()
+	outR, outW, _ := os.Pipe()
+	rl, err := readline.NewEx(&readline.Config{Prompt: "> ", Stdout: outW, FuncMakeRaw: success, FuncExitRaw: success})
+	require.NoError(t, err)
+	s := &Session{rl: rl}
+	_, err = s.reconnect(context.Background(), mockURL)
+	require.ErrorContains(t, err, "reconnection failed after 2 attempts: dial tcp")
+	require.ErrorContains(t, err, "connection refused")
+	outW.Close()
+	output, err := io.ReadAll(outR)
+	require.NoError(t, err)
+	require.Contains(t, string(output), "reconnecting in 1ms (attempt 2)...")
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// session event types
+const (
+	evOpen    = "open"
+	evMessage = "message"
+	evPing    = "ping"
+	evPong    = "pong"
+	evClose   = "close"
+	evError   = "error"
+)
+
+// message directions
+const (
+	dirSent     = "sent"
+	dirReceived = "received"
+)
+
+// event is the single record of session transcript
+type event struct {
+	Time      time.Time   `json:"ts"`
+	Event     string      `json:"event"`
+	Direction string      `json:"direction,omitempty"`
+	Type      string      `json:"type,omitempty"`
+	Payload   string      `json:"payload,omitempty"`
+	Size      *int        `json:"size,omitempty"`
+	Code      int         `json:"code,omitempty"`
+	Reason    string      `json:"reason,omitempty"`
+	URL       string      `json:"url,omitempty"`
+	Status    string      `json:"status,omitempty"`
+	Request   http.Header `json:"request,omitempty"`
+	Response  http.Header `json:"response,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// sensitiveHeaders are the handshake headers that are not recorded as is
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "Sec-WebSocket-Key", "Sec-WebSocket-Accept"}
+
+// redactHeaders returns the copy of headers with the values of sensitiveHeaders replaced by 'xxxxx'
+func redactHeaders(headers http.Header) http.Header {
+	res := headers.Clone()
+	for key, values := range res {
+		for _, name := range sensitiveHeaders {
+			if strings.EqualFold(key, name) {
+				for i := range values {
+					values[i] = "xxxxx"
+				}
+			}
+		}
+	}
+	return res
+}
+
+// messageEvent creates the event for the sent or received message. Binary payload is base64 encoded.
+func messageEvent(direction string, msgType int, data []byte) event {
+	size := len(data)
+	e := event{Event: evMessage, Direction: direction, Type: "text", Payload: string(data), Size: &size}
+	if msgType == websocket.BinaryMessage {
+		e.Type = "binary"
+		e.Payload = base64.StdEncoding.EncodeToString(data)
+	}
+	return e
+}
+
+// data returns the message payload and its websocket message type
+func (e event) data() (int, []byte, error) {
+	if e.Type == "binary" {
+		data, err := base64.StdEncoding.DecodeString(e.Payload)
+		return websocket.BinaryMessage, data, err
+	}
+	return websocket.TextMessage, []byte(e.Payload), nil
+}
+
+// output formats
+const (
+	outputText   = "text"
+	outputNDJSON = "ndjson"
+)
+
+// recorder writes the session events as JSON lines into the transcript file and into the output stream (in ndjson output mode)
+type recorder struct {
+	lock       sync.Mutex
+	w          io.WriteCloser
+	transcript *json.Encoder
+	stream     *json.Encoder
+}
+
+// newRecorder creates the recorder for transcript and stream, any of them can be nil. The stream is not closed by recorder.
+func newRecorder(transcript io.WriteCloser, stream io.Writer) *recorder {
+	r := &recorder{w: transcript}
+	if transcript != nil {
+		r.transcript = json.NewEncoder(transcript)
+	}
+	if stream != nil {
+		r.stream = json.NewEncoder(stream)
+	}
+	return r
+}
+
+// record writes the event with current time into transcript and stream. It is safe to call it on nil recorder.
+func (r *recorder) record(e event) {
+	r.write(e, true, true)
+}
+
+// recordReceived writes the received message event into transcript only, the stream gets it by output (after filtering)
+func (r *recorder) recordReceived(e event) {
+	r.write(e, true, false)
+}
+
+// output writes the received message event into stream only
+func (r *recorder) output(e event) {
+	r.write(e, false, true)
+}
+
+func (r *recorder) write(e event, transcript, stream bool) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if transcript && r.transcript != nil {
+		r.transcript.Encode(e)
+	}
+	if stream && r.stream != nil {
+		r.stream.Encode(e)
+	}
+}
+
+// Close closes the transcript writer. It is safe to call it on nil recorder.
+func (r *recorder) Close() error {
+	if r == nil || r.w == nil {
+		return nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.w.Close()
+}
+
+// recordErr records the error event
+func (r *recorder) recordErr(err error) {
+	if err != nil {
+		r.record(event{Event: evError, Error: err.Error()})
+	}
+}
+
+// recordClose records the sent or received close frame
+func (r *recorder) recordClose(direction string, code int, reason string) {
+	r.record(event{Event: evClose, Direction: direction, Code: code, Reason: reason})
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageEvent(t *testing.T) {
+	e := messageEvent(dirSent, websocket.BinaryMessage, []byte{0, 1, 2})
+	require.Equal(t, "binary", e.Type)
+	require.Equal(t, "AAEC", e.Payload)
+	require.Equal(t, 3, *e.Size)
+	msgType, data, err := e.data()
+	require.NoError(t, err)
+	require.Equal(t, websocket.BinaryMessage, msgType)
+	require.Equal(t, []byte{0, 1, 2}, data)
+	e = messageEvent(dirReceived, websocket.TextMessage, []byte("text"))
+	require.Equal(t, event{Event: evMessage, Direction: dirReceived, Type: "text", Payload: "text", Size: e.Size}, e)
+	msgType, data, err = e.data()
+	require.NoError(t, err)
+	require.Equal(t, websocket.TextMessage, msgType)
+	require.Equal(t, []byte("text"), data)
+}
+
+func TestRedactHeaders(t *testing.T) {
+	headers := http.Header{"Authorization": {"Bearer token"}, "Cookie": {"a=1", "b=2"}, "Origin": {"http://localhost"}}
+	redacted := redactHeaders(headers)
+	require.Equal(t, http.Header{"Authorization": {"xxxxx"}, "Cookie": {"xxxxx", "xxxxx"}, "Origin": {"http://localhost"}}, redacted)
+	require.Equal(t, "Bearer token", headers.Get("Authorization"))
+	// the header names are canonicalized by net/http as 'Sec-Websocket-Accept'
+	resp, err := http.ReadResponse(bufio.NewReader(strings.NewReader("HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\nSec-WebSocket-Accept: s3pPLMBiTxaQ9kYGzzhZRbK+xOo=\r\nSet-Cookie: session=s1\r\n\r\n")), nil)
+	require.NoError(t, err)
+	redacted = redactHeaders(resp.Header)
+	require.Equal(t, "xxxxx", redacted.Get("Sec-WebSocket-Accept"))
+	require.Equal(t, "xxxxx", redacted.Get("Set-Cookie"))
+	require.Equal(t, "websocket", redacted.Get("Upgrade"))
+	require.NotContains(t, fmt.Sprint(redacted), "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=")
+}
+
+func TestNilRecorder(t *testing.T) {
+	var r *recorder
+	r.record(event{Event: evOpen})
+	r.recordErr(os.ErrClosed)
+	require.NoError(t, r.Close())
+}
+
+func TestRecord(t *testing.T) {
+	srv := newMockServer(0)
+	defer srv.Close()
+	options.count = 1
+	defer func() { options.count = 0 }()
+	atomic.StoreInt64(&srv.Mode, websocket.BinaryMessage)
+	srv.ToSend <- "bin"
+	path := filepath.Join(t.TempDir(), "record.jsonl")
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	s := &Session{rec: newRecorder(file, nil)}
+	errs := s.batch(mockURL, strings.NewReader("one\n"), &bytes.Buffer{})
+	require.Empty(t, errs)
+	require.NoError(t, s.rec.Close())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	events := []event{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		e := event{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		require.False(t, e.Time.IsZero())
+		events = append(events, e)
+	}
+	require.Len(t, events, 4)
+	require.Equal(t, evOpen, events[0].Event)
+	require.Equal(t, mockURL, events[0].URL)
+	require.Equal(t, "101 Switching Protocols", events[0].Status)
+	require.Equal(t, []string{"xxxxx"}, events[0].Request["Sec-WebSocket-Key"])
+	require.Equal(t, "websocket", events[0].Response.Get("Upgrade"))
+	// the order of sent and received messages is not determined
+	msgs := map[string]event{}
+	for _, e := range events[1:3] {
+		require.Equal(t, evMessage, e.Event)
+		msgs[e.Direction] = e
+	}
+	require.Equal(t, "text", msgs[dirSent].Type)
+	require.Equal(t, "one", msgs[dirSent].Payload)
+	require.Equal(t, "binary", msgs[dirReceived].Type)
+	require.Equal(t, "Ymlu", msgs[dirReceived].Payload)
+	require.Equal(t, 3, *msgs[dirReceived].Size)
+	require.Equal(t, event{Time: events[3].Time, Event: evClose, Direction: dirSent, Code: 1000, Reason: "client disconnection"}, events[3])
+}
+
+func TestNDJSONOutput(t *testing.T) {
+	srv := newMockServer(0)
+	defer srv.Close()
+	options.count = 1
+	options.output = outputNDJSON
+	options.filter = regexp.MustCompile("id")
+	var err error
+	options.extract, err = compileQueryList(".id")
+	require.NoError(t, err)
+	defer func() {
+		options.count = 0
+		options.output = ""
+		options.filter = nil
+		options.extract = nil
+	}()
+	srv.ToSend <- "filtered"
+	srv.ToSend <- `{"id":7}`
+	stream, file := &bytes.Buffer{}, &bytes.Buffer{}
+	s := &Session{rec: newRecorder(nopCloser{file}, stream)}
+	out := &bytes.Buffer{}
+	errs := s.batch(mockURL, strings.NewReader("request\n"), out)
+	require.Empty(t, errs)
+	require.NoError(t, s.rec.Close())
+	require.Empty(t, out.String())
+	received := func(data string) []event {
+		res := []event{}
+		for _, line := range strings.Split(strings.TrimSpace(data), "\n") {
+			e := event{}
+			require.NoError(t, json.Unmarshal([]byte(line), &e))
+			if e.Direction == dirReceived && e.Event == evMessage {
+				res = append(res, e)
+			}
+		}
+		return res
+	}
+	transcript := received(file.String())
+	require.Len(t, transcript, 2)
+	require.Equal(t, "filtered", transcript[0].Payload)
+	require.Equal(t, `{"id":7}`, transcript[1].Payload)
+	output := received(stream.String())
+	require.Len(t, output, 1)
+	require.Equal(t, "7", output[0].Payload)
+	require.Equal(t, 1, *output[0].Size)
+	require.Len(t, strings.Split(strings.TrimSpace(stream.String()), "\n"), 4)
+}
+
+// nopCloser is the transcript writer that is kept open for checks
+type nopCloser struct {
+	*bytes.Buffer
+}
+
+func (nopCloser) Close() error { return nil }
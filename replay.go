@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var replayOptions struct {
+	speed  string
+	verify bool
+	wait   time.Duration
+}
+
+func newReplayCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replay transcript.jsonl URL",
+		Short: "replay the sent messages from recorded transcript (see --record) against the server",
+		Args:  cobra.ExactArgs(2),
+		Run:   replay,
+	}
+	cmd.Flags().StringVar(&replayOptions.speed, "speed", "1x", "replay speed: 2x is twice faster than recorded, 0 - as fast as possible")
+	cmd.Flags().BoolVar(&replayOptions.verify, "verify", false, "verify that received messages match the recorded ones")
+	cmd.Flags().DurationVar(&replayOptions.wait, "wait", time.Second, "time to wait for incoming messages after the last sent one")
+	return cmd
+}
+
+func replay(cmd *cobra.Command, args []string) {
+	speed, err := parseSpeed(replayOptions.speed)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	file, err := os.Open(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	transcript, err := readTranscript(file)
+	file.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	dest, err := prepare(args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	rec, err := openRecorder()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	s := &Session{rec: rec}
+	errs := s.replay(dest.String(), transcript, speed, os.Stdout)
+	rec.Close()
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(exitCode(errs))
+	}
+}
+
+// parseSpeed parses the replay speed like '2x', '0.5' or '0'
+func parseSpeed(speed string) (float64, error) {
+	res, err := strconv.ParseFloat(strings.TrimSuffix(speed, "x"), 64)
+	if err != nil || res < 0 {
+		return 0, fmt.Errorf("incorrect speed: %s", speed)
+	}
+	return res, nil
+}
+
+// readTranscript reads the recorded session events. Only message events are returned.
+func readTranscript(r io.Reader) ([]event, error) {
+	events := []event{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	for n := 1; scanner.Scan(); n++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		e := event{}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("transcript line %d: %w", n, err)
+		}
+		if e.Event == evMessage {
+			if e.Direction != dirSent && e.Direction != dirReceived {
+				return nil, fmt.Errorf("transcript line %d: unknown message direction: '%s'", n, e.Direction)
+			}
+			events = append(events, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("transcript reading error: %w", err)
+	}
+	return events, nil
+}
+
+// replay sends the recorded sent messages keeping the recorded intervals between them divided by speed (0 means without delays).
+// With replayOptions.verify the received messages are compared with recorded ones and all divergences are reported as errors.
+func (s *Session) replay(url string, transcript []event, speed float64, out io.Writer) []error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ws, err := s.dial(ctx, url)
+	if err != nil {
+		return []error{err}
+	}
+	defer s.closeConn(ws)
+	s.setConn(ws)
+	s.cancel = cancel
+	s.errors = []error{}
+	go func() {
+		sig := make(chan os.Signal, 2)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		fmt.Fprintf(os.Stderr, "\n%s signal received, exiting...\n", <-sig)
+		s.cancel()
+	}()
+	expected := []event{}
+	for _, e := range transcript {
+		if e.Direction == dirReceived {
+			expected = append(expected, e)
+		}
+	}
+	received := make(chan event, 1)
+	go func() {
+		defer close(received)
+		for {
+			msgType, data, err := ws.ReadMessage()
+			if err != nil {
+				if ctx.Err() == nil && !isNormalClose(err) {
+					s.setErr(fmt.Errorf("reading error: `%w`", err))
+				}
+				return
+			}
+			e := messageEvent(dirReceived, msgType, data)
+			s.rec.record(e)
+			fmt.Fprint(out, formatMessage(s.getPrefix()+"< ", e.Payload, rxSprintf))
+			select {
+			case received <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.sendTranscript(ctx, transcript, speed, out)
+	}()
+	count := 0
+	var timeout <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return s.getErr()
+		case <-done:
+			done = nil
+			if len(s.getErr()) > 0 {
+				return s.getErr()
+			}
+			timeout = time.After(replayOptions.wait)
+		case <-timeout:
+			if replayOptions.verify && count < len(expected) {
+				s.setErr(fmt.Errorf("divergence: %d of %d recorded messages are not received", len(expected)-count, len(expected)))
+			}
+			return s.getErr()
+		case e, ok := <-received:
+			if !ok {
+				if done != nil {
+					cancel()
+					<-done
+				}
+				if replayOptions.verify && count < len(expected) {
+					s.setErr(fmt.Errorf("divergence: connection closed, %d of %d recorded messages are not received", len(expected)-count, len(expected)))
+				}
+				return s.getErr()
+			}
+			if replayOptions.verify {
+				if count >= len(expected) {
+					s.setErr(fmt.Errorf("divergence: unexpected message #%d: %s", count+1, e.Payload))
+				} else if exp := expected[count]; exp.Type != e.Type || exp.Payload != e.Payload {
+					s.setErr(fmt.Errorf("divergence: message #%d: expected %s '%s', received %s '%s'", count+1, exp.Type, exp.Payload, e.Type, e.Payload))
+				}
+			}
+			count++
+		}
+	}
+}
+
+// sendTranscript sends the recorded sent messages with the recorded delays divided by speed
+func (s *Session) sendTranscript(ctx context.Context, transcript []event, speed float64, out io.Writer) {
+	if len(transcript) == 0 {
+		return
+	}
+	start := time.Now()
+	origin := transcript[0].Time
+	for _, e := range transcript {
+		if e.Direction != dirSent {
+			continue
+		}
+		if speed > 0 {
+			delay := time.Duration(float64(e.Time.Sub(origin))/speed) - time.Since(start)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+		}
+		msgType, data, err := e.data()
+		if err != nil {
+			s.setErr(fmt.Errorf("incorrect recorded message: %w", err))
+			return
+		}
+		if err = s.write(msgType, data); err != nil {
+			if ctx.Err() == nil {
+				s.setErr(err)
+			}
+			return
+		}
+		fmt.Fprint(out, formatMessage(s.getPrefix()+"> ", e.Payload, txSprintf))
+	}
+}
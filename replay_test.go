@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/slytomcat/ws/server"
+	"github.com/stretchr/testify/require"
+)
+
+func newEchoServer(t *testing.T) {
+	u, _ := url.Parse(mockURL)
+	s := server.NewServer(u.Host)
+	s.WSHandleFunc(u.Path, server.EchoHandler)
+	go s.ListenAndServe()
+	t.Cleanup(func() { s.Close() })
+	require.Eventually(t, func() bool {
+		conn, err := (&Session{}).dial(context.Background(), mockURL)
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	}, 100*time.Millisecond, 5*time.Millisecond)
+}
+
+func TestParseSpeed(t *testing.T) {
+	for in, exp := range map[string]float64{"1x": 1, "2x": 2, "0.5": 0.5, "0": 0} {
+		speed, err := parseSpeed(in)
+		require.NoError(t, err)
+		require.Equal(t, exp, speed)
+	}
+	_, err := parseSpeed("fast")
+	require.EqualError(t, err, "incorrect speed: fast")
+	_, err = parseSpeed("-1x")
+	require.EqualError(t, err, "incorrect speed: -1x")
+}
+
+func TestReadTranscript(t *testing.T) {
+	transcript := `{"ts":"2024-09-20T10:00:00Z","event":"open","url":"ws://localhost:8080/ws"}
+
+{"ts":"2024-09-20T10:00:01Z","event":"message","direction":"sent","type":"text","payload":"a"}
+{"ts":"2024-09-20T10:00:02Z","event":"ping","direction":"received"}
+{"ts":"2024-09-20T10:00:03Z","event":"message","direction":"received","type":"binary","payload":"AAE="}
+`
+	events, err := readTranscript(strings.NewReader(transcript))
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, dirSent, events[0].Direction)
+	require.Equal(t, "a", events[0].Payload)
+	require.Equal(t, dirReceived, events[1].Direction)
+	_, data, err := events[1].data()
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 1}, data)
+	_, err = readTranscript(strings.NewReader("{}\n{"))
+	require.EqualError(t, err, "transcript line 2: unexpected end of JSON input")
+	_, err = readTranscript(strings.NewReader(`{"event":"message","direction":"up"}`))
+	require.EqualError(t, err, "transcript line 1: unknown message direction: 'up'")
+}
+
+func testTranscript(received ...string) []event {
+	start := time.Now()
+	events := []event{}
+	for i, payload := range []string{"first", "second"} {
+		e := messageEvent(dirSent, 1, []byte(payload))
+		e.Time = start.Add(time.Duration(i*40) * time.Millisecond)
+		events = append(events, e)
+	}
+	for _, payload := range received {
+		events = append(events, messageEvent(dirReceived, 1, []byte(payload)))
+	}
+	return events
+}
+
+func TestReplay(t *testing.T) {
+	newEchoServer(t)
+	replayOptions.verify = true
+	replayOptions.wait = 20 * time.Millisecond
+	defer func() {
+		replayOptions.verify = false
+		replayOptions.wait = 0
+	}()
+	out := &bytes.Buffer{}
+	start := time.Now()
+	errs := (&Session{}).replay(mockURL, testTranscript("first", "second"), 1, out)
+	require.Empty(t, errs)
+	require.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+	require.Contains(t, out.String(), "> second\n")
+	require.Contains(t, out.String(), "< second\n")
+	// as fast as possible
+	start = time.Now()
+	errs = (&Session{}).replay(mockURL, testTranscript("first", "second"), 0, out)
+	require.Empty(t, errs)
+	require.Less(t, time.Since(start), 40*time.Millisecond+replayOptions.wait)
+}
+
+func TestReplayDivergence(t *testing.T) {
+	newEchoServer(t)
+	replayOptions.verify = true
+	replayOptions.wait = 20 * time.Millisecond
+	defer func() {
+		replayOptions.verify = false
+		replayOptions.wait = 0
+	}()
+	errs := (&Session{}).replay(mockURL, testTranscript("first", "other", "third"), 0, &bytes.Buffer{})
+	require.Len(t, errs, 2)
+	require.EqualError(t, errs[0], "divergence: message #2: expected text 'other', received text 'second'")
+	require.EqualError(t, errs[1], "divergence: 1 of 3 recorded messages are not received")
+	errs = (&Session{}).replay(mockURL, testTranscript("first"), 0, &bytes.Buffer{})
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs[0], "divergence: unexpected message #2: second")
+}
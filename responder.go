@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// responderFlags are raw auto-reply options
+var responderFlags struct {
+	rules []string
+	file  string
+}
+
+// replyQueryRe finds the JSON query references like ${.id} in the reply of JSON predicate rule
+var replyQueryRe = regexp.MustCompile(`\$\{(\.[^}]*)\}`)
+
+// responder is the auto-reply rule: the reply is sent for each received message that matches the rule
+type responder struct {
+	match *matcher
+	reply string
+	// queries are the compiled references of JSON predicate rule reply
+	queries map[string]*query
+}
+
+// compileResponders compiles the rules from responderFlags: --respond rules go first, then the rules from file
+func compileResponders() ([]*responder, error) {
+	rules := responderFlags.rules
+	if responderFlags.file != "" {
+		fileRules, err := readRules(responderFlags.file)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules[:len(rules):len(rules)], fileRules...)
+	}
+	responders := make([]*responder, 0, len(rules))
+	for _, rule := range rules {
+		r, err := compileResponder(rule)
+		if err != nil {
+			return nil, err
+		}
+		responders = append(responders, r)
+	}
+	return responders, nil
+}
+
+// readRules reads the rules file: one rule per line, empty lines and lines started with '#' are skipped
+func readRules(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("rules file reading error: %w", err)
+	}
+	defer file.Close()
+	rules := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			rules = append(rules, line)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("rules file reading error: %w", err)
+	}
+	return rules, nil
+}
+
+// compileResponder compiles the rule 'match=>reply'. The match is regexp or JSON predicate (see compileMatcher).
+// The regexp rule reply can contain the captured groups like $1 or ${name}, the JSON predicate rule reply can
+// contain the values selected from the message like ${.id}, they are inserted as JSON (strings are quoted and escaped).
+func compileResponder(rule string) (*responder, error) {
+	expr, reply, ok := strings.Cut(rule, "=>")
+	if expr = strings.TrimSpace(expr); !ok || expr == "" {
+		return nil, fmt.Errorf("incorrect auto-reply rule '%s', expected 'match=>reply'", rule)
+	}
+	m, err := compileMatcher(expr)
+	if err != nil {
+		return nil, err
+	}
+	r := &responder{match: m, reply: strings.TrimSpace(reply)}
+	if m.q != nil {
+		r.queries = map[string]*query{}
+		for _, ref := range replyQueryRe.FindAllStringSubmatch(r.reply, -1) {
+			if r.queries[ref[1]], err = compileQuery(ref[1]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return r, nil
+}
+
+// replyFor returns the reply for the message text. It returns false when the message doesn't match the rule.
+func (r *responder) replyFor(text string) (string, bool) {
+	if r.match.re != nil {
+		idx := r.match.re.FindStringSubmatchIndex(text)
+		if idx == nil {
+			return "", false
+		}
+		return string(r.match.re.ExpandString(nil, r.reply, text, idx)), true
+	}
+	v, ok := decodeJSON(text)
+	if !ok || !r.match.q.match(v) {
+		return "", false
+	}
+	return replyQueryRe.ReplaceAllStringFunc(r.reply, func(ref string) string {
+		res, _ := json.Marshal(r.queries[ref[2:len(ref)-1]].eval(v))
+		return string(res)
+	}), true
+}
+
+// respond sends the replies of all options.responders rules that match the received message
+func (s *Session) respond(text string) error {
+	for _, r := range options.responders {
+		reply, ok := r.replyFor(text)
+		if !ok {
+			continue
+		}
+		if err := s.write(websocket.TextMessage, []byte(reply)); err != nil {
+			return fmt.Errorf("auto-reply %w", err)
+		}
+		if options.output != outputNDJSON {
+			fmt.Fprint(s.output(), formatMessage(s.getPrefix()+"> ", reply, arSprintf))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponder(t *testing.T) {
+	r, err := compileResponder(`.op == "ping" => {"op": "pong", "id": ${.id}, "name": ${.user.name}, "tags": ${.tags}}`)
+	require.NoError(t, err)
+	reply, ok := r.replyFor(`{"op": "ping", "id": 7, "user": {"name": "bob \"the\" \\builder"}, "tags": ["a"]}`)
+	require.True(t, ok)
+	require.Equal(t, `{"op": "pong", "id": 7, "name": "bob \"the\" \\builder", "tags": ["a"]}`, reply)
+	require.True(t, json.Valid([]byte(reply)))
+	_, ok = r.replyFor(`{"op": "trade"}`)
+	require.False(t, ok)
+	_, ok = r.replyFor("ping")
+	require.False(t, ok)
+
+	r, err = compileResponder(`^hello (?P<name>\w+) (\d+)$=>hi ${name} #$2`)
+	require.NoError(t, err)
+	reply, ok = r.replyFor("hello bob 42")
+	require.True(t, ok)
+	require.Equal(t, "hi bob #42", reply)
+	_, ok = r.replyFor("bye bob")
+	require.False(t, ok)
+
+	_, err = compileResponder("no reply")
+	require.EqualError(t, err, "incorrect auto-reply rule 'no reply', expected 'match=>reply'")
+	_, err = compileResponder("=>reply")
+	require.EqualError(t, err, "incorrect auto-reply rule '=>reply', expected 'match=>reply'")
+	_, err = compileResponder("[=>reply")
+	require.ErrorContains(t, err, "compiling regexp '[' error: ")
+	_, err = compileResponder("(=>reply")
+	require.ErrorContains(t, err, "query '(': unexpected 'end of query'; compiling regexp '(' error: ")
+
+	r, err = compileResponder(`(done|ready) => ack $1`)
+	require.NoError(t, err)
+	reply, ok = r.replyFor("server is ready")
+	require.True(t, ok)
+	require.Equal(t, "ack ready", reply)
+	_, err = compileResponder(".op => ${.a[}")
+	require.Error(t, err)
+}
+
+func TestCompileResponders(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rules")
+	require.NoError(t, os.WriteFile(file, []byte("# heartbeats\n\n.op == \"ping\" => {\"op\": \"pong\"}\n^PING$ => PONG\n"), 0o600))
+	responderFlags.rules, responderFlags.file = []string{"a=>b"}, file
+	defer func() { responderFlags.rules, responderFlags.file = nil, "" }()
+	responders, err := compileResponders()
+	require.NoError(t, err)
+	require.Len(t, responders, 3)
+	require.Equal(t, "b", responders[0].reply)
+	require.Equal(t, "PONG", responders[2].reply)
+	responderFlags.file = filepath.Join(t.TempDir(), "missing")
+	_, err = compileResponders()
+	require.ErrorContains(t, err, "rules file reading error: ")
+}
+
+func TestAutoReply(t *testing.T) {
+	srv := newMockServer(0)
+	defer srv.Close()
+	r, err := compileResponder(`.op == "ping" => {"op":"pong","id":${.id}}`)
+	require.NoError(t, err)
+	options.responders = []*responder{r}
+	options.count = 2
+	defer func() { options.responders, options.count = nil, 0 }()
+	srv.ToSend <- `{"op":"ping","id":1}`
+	srv.ToSend <- `{"op":"data"}`
+	out := &bytes.Buffer{}
+	errs := (&Session{}).batch(mockURL, strings.NewReader(""), out)
+	require.Empty(t, errs)
+	require.Equal(t, "{\"op\":\"ping\",\"id\":1}\n{\"op\":\"data\"}\n", out.String())
+	require.Eventually(t, func() bool { return len(srv.Received) == 1 }, 50*time.Millisecond, 2*time.Millisecond)
+	require.Equal(t, `{"op":"pong","id":1}`, <-srv.Received)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scheduleFlags are raw periodic sending options: --every and --send are paired by order
+var scheduleFlags struct {
+	every []string
+	send  []string
+}
+
+// placeholderRe finds the placeholders like {{now}} in the periodic message template
+var placeholderRe = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// placeholders returns the values of periodic message template placeholders for message number seq
+var placeholders = map[string]func(seq int) string{
+	"now":  func(int) string { return strconv.FormatInt(time.Now().UnixMilli(), 10) },
+	"time": func(int) string { return time.Now().UTC().Format(time.RFC3339Nano) },
+	"seq":  strconv.Itoa,
+}
+
+// schedule is the message template that is sent each interval
+type schedule struct {
+	every    time.Duration
+	template string
+	stop     func()
+}
+
+// schedules is the set of running schedules of session
+type schedules struct {
+	lock    sync.Mutex
+	last    int
+	running map[int]*schedule
+	// once starts options.schedules in console session after the first successful connection setup
+	once sync.Once
+}
+
+// compileSchedules makes the schedules from scheduleFlags
+func compileSchedules() ([]*schedule, error) {
+	if len(scheduleFlags.every) != len(scheduleFlags.send) {
+		return nil, errors.New("--every and --send should be used in pairs")
+	}
+	res := make([]*schedule, len(scheduleFlags.every))
+	for i, every := range scheduleFlags.every {
+		sc, err := newSchedule(every, scheduleFlags.send[i])
+		if err != nil {
+			return nil, err
+		}
+		res[i] = sc
+	}
+	return res, nil
+}
+
+// newSchedule checks the interval and the message template placeholders
+func newSchedule(every, template string) (*schedule, error) {
+	interval, err := time.ParseDuration(every)
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("incorrect interval: %s", every)
+	}
+	for _, ref := range placeholderRe.FindAllStringSubmatch(template, -1) {
+		if _, ok := placeholders[ref[1]]; !ok {
+			return nil, fmt.Errorf("unknown placeholder '%s', use {{now}}, {{time}} or {{seq}}", ref[0])
+		}
+	}
+	return &schedule{every: interval, template: template}, nil
+}
+
+// message makes the message number seq from template
+func (sc *schedule) message(seq int) string {
+	return placeholderRe.ReplaceAllStringFunc(sc.template, func(ref string) string {
+		return placeholders[placeholderRe.FindStringSubmatch(ref)[1]](seq)
+	})
+}
+
+// startSchedule starts sending the schedule messages and returns the schedule number
+func (s *Session) startSchedule(sc *schedule) int {
+	s.schedules.lock.Lock()
+	defer s.schedules.lock.Unlock()
+	if s.schedules.running == nil {
+		s.schedules.running = map[int]*schedule{}
+	}
+	s.schedules.last++
+	id := s.schedules.last
+	sc = &schedule{every: sc.every, template: sc.template}
+	ticker := time.NewTicker(sc.every)
+	done := make(chan struct{})
+	sc.stop = func() {
+		ticker.Stop()
+		close(done)
+	}
+	s.schedules.running[id] = sc
+	go func() {
+		for seq := 0; ; seq++ {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				select {
+				case <-done: // stopped while the tick was waiting: select doesn't prefer done
+					return
+				default:
+				}
+				if err := s.sendMsg(sc.message(seq)); err != nil {
+					fmt.Fprint(s.output(), ctSprintf("%sschedule #%d: %v\n", s.getPrefix(), id, err))
+				}
+			}
+		}
+	}()
+	return id
+}
+
+// startSchedules starts options.schedules and returns the function that stops all schedules
+func (s *Session) startSchedules() func() {
+	for _, sc := range options.schedules {
+		s.startSchedule(sc)
+	}
+	return s.stopSchedules
+}
+
+// stopSchedule stops the schedule by number, it returns false when there is no such schedule
+func (s *Session) stopSchedule(id int) bool {
+	s.schedules.lock.Lock()
+	defer s.schedules.lock.Unlock()
+	sc, ok := s.schedules.running[id]
+	if ok {
+		sc.stop()
+		delete(s.schedules.running, id)
+	}
+	return ok
+}
+
+// stopSchedules stops all running schedules
+func (s *Session) stopSchedules() {
+	for _, id := range s.scheduleIDs() {
+		s.stopSchedule(id)
+	}
+}
+
+// scheduleIDs returns the sorted numbers of running schedules
+func (s *Session) scheduleIDs() []int {
+	s.schedules.lock.Lock()
+	defer s.schedules.lock.Unlock()
+	ids := make([]int, 0, len(s.schedules.running))
+	for id := range s.schedules.running {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func (s *Session) cmdEvery(arg string) error {
+	every, template, _ := strings.Cut(strings.TrimSpace(arg), " ")
+	if template = strings.TrimSpace(template); template == "" {
+		return errors.New("use: /every <interval> <message>")
+	}
+	sc, err := newSchedule(every, template)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(s.output(), ctSprintf("schedule #%d started\n", s.startSchedule(sc)))
+	return nil
+}
+
+func (s *Session) cmdSchedules(string) error {
+	ids := s.scheduleIDs()
+	if len(ids) == 0 {
+		fmt.Fprint(s.output(), ctSprintf("no schedules\n"))
+		return nil
+	}
+	list := ""
+	s.schedules.lock.Lock()
+	for _, id := range ids {
+		if sc, ok := s.schedules.running[id]; ok {
+			list += fmt.Sprintf("  #%d every %s: %s\n", id, sc.every, sc.template)
+		}
+	}
+	s.schedules.lock.Unlock()
+	fmt.Fprint(s.output(), ctSprintf("%s", list))
+	return nil
+}
+
+func (s *Session) cmdStop(arg string) error {
+	if arg = strings.TrimSpace(arg); arg == "all" {
+		s.stopSchedules()
+		fmt.Fprint(s.output(), ctSprintf("all schedules stopped\n"))
+		return nil
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
+	if err != nil {
+		return errors.New("use: /stop <number>|all")
+	}
+	if !s.stopSchedule(id) {
+		return fmt.Errorf("no schedule #%d", id)
+	}
+	fmt.Fprint(s.output(), ctSprintf("schedule #%d stopped\n", id))
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chzyer/readline"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileSchedules(t *testing.T) {
+	defer func() { scheduleFlags.every, scheduleFlags.send = nil, nil }()
+	scheduleFlags.every, scheduleFlags.send = []string{"30s", "1m"}, []string{`{"op":"heartbeat","ts":{{now}}}`, "tick {{ seq }}"}
+	schedules, err := compileSchedules()
+	require.NoError(t, err)
+	require.Len(t, schedules, 2)
+	require.Equal(t, 30*time.Second, schedules[0].every)
+	require.Equal(t, "tick 3", schedules[1].message(3))
+	before := time.Now().UnixMilli()
+	msg := schedules[0].message(0)
+	require.True(t, strings.HasPrefix(msg, `{"op":"heartbeat","ts":`))
+	ts, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(msg, `{"op":"heartbeat","ts":`), "}"), 10, 64)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, ts, before)
+
+	scheduleFlags.send = scheduleFlags.send[:1]
+	_, err = compileSchedules()
+	require.EqualError(t, err, "--every and --send should be used in pairs")
+	_, err = newSchedule("0s", "msg")
+	require.EqualError(t, err, "incorrect interval: 0s")
+	_, err = newSchedule("often", "msg")
+	require.EqualError(t, err, "incorrect interval: often")
+	_, err = newSchedule("1s", "{{uuid}}")
+	require.EqualError(t, err, "unknown placeholder '{{uuid}}', use {{now}}, {{time}} or {{seq}}")
+}
+
+func TestSchedules(t *testing.T) {
+	srv := newMockServer(0)
+	defer srv.Close()
+	conn := newMockConn()
+	defer TryCloseNormally(conn, "test finished")
+	outR, outW, _ := os.Pipe()
+	rl, err := readline.NewEx(&readline.Config{Prompt: "> ", Stdout: outW, FuncMakeRaw: success, FuncExitRaw: success})
+	require.NoError(t, err)
+	s := &Session{ws: conn, rl: rl, cancel: func() {}}
+
+	require.NoError(t, s.runCommand("/every 10ms msg {{seq}}"))
+	require.Equal(t, "msg 0", <-srv.Received)
+	require.Equal(t, "msg 1", <-srv.Received)
+	require.NoError(t, s.runCommand("/schedules"))
+	require.NoError(t, s.runCommand("/stop 1"))
+	require.Never(t, func() bool { return len(srv.Received) > 1 }, 30*time.Millisecond, 5*time.Millisecond)
+	require.EqualError(t, s.runCommand("/stop 1"), "no schedule #1")
+	require.EqualError(t, s.runCommand("/stop"), "use: /stop <number>|all")
+	require.EqualError(t, s.runCommand("/every 1s"), "use: /every <interval> <message>")
+	require.NoError(t, s.runCommand("/every 1h a"))
+	require.NoError(t, s.runCommand("/stop all"))
+	require.NoError(t, s.runCommand("/schedules"))
+	require.Empty(t, s.scheduleIDs())
+
+	outW.Close()
+	output, err := io.ReadAll(outR)
+	require.NoError(t, err)
+	out := string(output)
+	require.Contains(t, out, "schedule #1 started\n")
+	require.Contains(t, out, "  #1 every 10ms: msg {{seq}}\n")
+	require.Contains(t, out, "schedule #1 stopped\n")
+	require.Contains(t, out, "all schedules stopped\n")
+	require.Contains(t, out, "no schedules\n")
+}
+
+func TestBatchSchedules(t *testing.T) {
+	srv := newMockServer(0)
+	defer srv.Close()
+	sc, err := newSchedule("10ms", "heartbeat {{seq}}")
+	require.NoError(t, err)
+	options.schedules = []*schedule{sc}
+	options.wait = 35 * time.Millisecond
+	defer func() { options.schedules, options.wait = nil, 0 }()
+	errs := (&Session{}).batch(mockURL, strings.NewReader(""), &bytes.Buffer{})
+	require.Empty(t, errs)
+	require.Equal(t, "heartbeat 0", <-srv.Received)
+	require.Equal(t, "heartbeat 1", <-srv.Received)
+}
+
+func TestServeSchedules(t *testing.T) {
+	srv := newMockServer(0)
+	defer srv.Close()
+	sc, err := newSchedule("5ms", "tick {{seq}}")
+	require.NoError(t, err)
+	options.schedules = []*schedule{sc}
+	options.initMsg = "init"
+	defer func() { options.schedules, options.initMsg = nil, "" }()
+	// the connection is served without console: closing readline while its terminal goroutine starts is racy
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := &Session{}
+	ws, err := s.dial(ctx, mockURL)
+	require.NoError(t, err)
+	s.setConn(ws)
+	served := make(chan error, 1)
+	go func() {
+		served <- s.serve(ctx, ws)
+	}()
+	require.Equal(t, "init", <-srv.Received)
+	require.Equal(t, "tick 0", <-srv.Received)
+	cancel()
+	require.NoError(t, <-served)
+	s.stopSchedules()
+	s.closeConn(ws)
+	require.Empty(t, s.scheduleIDs())
+}
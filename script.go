@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultExpectTimeout is the expect step timeout when it is not set in script
+const defaultExpectTimeout = 10 * time.Second
+
+// script is the scripted conversation:
+//
+//	vars:                     initial variables
+//	  user: guest
+//	timeout: 5s               default timeout of expect steps
+//	steps:
+//	  - send: '{"op": "login", "user": "${user}", "token": "${TOKEN}"}'
+//	  - expect: '.op == "login" && .ok'   regexp or JSON predicate (see --until)
+//	    timeout: 3s
+//	  - capture:                          values from the last expected message
+//	      session: .session.id
+//	  - sleep: 1s
+//	  - ping: payload
+//	  - close: 1000 bye
+//
+// The ${name} in send, expect, ping and close is replaced with variable value or environment variable.
+type script struct {
+	Vars    map[string]string `yaml:"vars"`
+	Timeout time.Duration     `yaml:"timeout"`
+	Steps   []step            `yaml:"steps"`
+}
+
+// step is the single action of script
+type step struct {
+	action  string
+	line    int
+	Send    string            `yaml:"send"`
+	Expect  string            `yaml:"expect"`
+	Timeout time.Duration     `yaml:"timeout"`
+	Capture map[string]string `yaml:"capture"`
+	Sleep   time.Duration     `yaml:"sleep"`
+	Ping    string            `yaml:"ping"`
+	Close   string            `yaml:"close"`
+	queries map[string]*query
+}
+
+var scriptVarRe = regexp.MustCompile(`\$\{(\w+)\}`)
+
+func newRunCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "run script.yaml URL",
+		Short: "run the scripted conversation (send, expect, capture, sleep, ping, close steps) against the server",
+		Args:  cobra.ExactArgs(2),
+		Run:   run,
+	}
+}
+
+func run(cmd *cobra.Command, args []string) {
+	file, err := os.Open(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	sc, err := loadScript(file)
+	file.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	dest, err := prepare(args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	rec, err := openRecorder()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	s := &Session{rec: rec}
+	errs := s.runScript(dest.String(), sc, os.Stdout)
+	rec.Close()
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(exitCode(errs))
+	}
+}
+
+// loadScript reads and validates the script
+func loadScript(r io.Reader) (*script, error) {
+	sc := &script{}
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(sc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("script parsing error: %w", err)
+	}
+	if len(sc.Steps) == 0 {
+		return nil, errors.New("script has no steps")
+	}
+	if sc.Timeout == 0 {
+		sc.Timeout = defaultExpectTimeout
+	}
+	for i := range sc.Steps {
+		st := &sc.Steps[i]
+		if st.action == "expect" && st.Timeout == 0 {
+			st.Timeout = sc.Timeout
+		}
+		if st.action == "capture" {
+			st.queries = map[string]*query{}
+			for name, expr := range st.Capture {
+				q, err := compileQuery(expr)
+				if err != nil {
+					return nil, fmt.Errorf("script parsing error: line %d: %w", st.line, err)
+				}
+				st.queries[name] = q
+			}
+		}
+	}
+	return sc, nil
+}
+
+// UnmarshalYAML decodes the step and checks that it has exactly one action
+func (st *step) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: step must be a mapping", node.Line)
+	}
+	type plain step
+	if err := node.Decode((*plain)(st)); err != nil {
+		return err
+	}
+	st.line = node.Line
+	keys := []string{}
+	for i := 0; i < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		switch key {
+		case "send", "expect", "capture", "sleep", "ping", "close":
+			if st.action != "" {
+				return fmt.Errorf("line %d: step has several actions: %s and %s", node.Line, st.action, key)
+			}
+			st.action = key
+		case "timeout":
+		default:
+			return fmt.Errorf("line %d: unknown step field '%s'", node.Line, key)
+		}
+		keys = append(keys, key)
+	}
+	if st.action == "" {
+		return fmt.Errorf("line %d: step has no action (send, expect, capture, sleep, ping or close)", node.Line)
+	}
+	if st.action != "expect" && len(keys) > 1 {
+		return fmt.Errorf("line %d: timeout is allowed for expect step only", node.Line)
+	}
+	return nil
+}
+
+// expand replaces ${name} with the variable value or environment variable
+func expand(text string, vars map[string]string) (string, error) {
+	var err error
+	res := scriptVarRe.ReplaceAllStringFunc(text, func(ref string) string {
+		name := scriptVarRe.FindStringSubmatch(ref)[1]
+		if value, ok := vars[name]; ok {
+			return value
+		}
+		if value, ok := os.LookupEnv(name); ok {
+			return value
+		}
+		err = fmt.Errorf("undefined variable '%s'", name)
+		return ref
+	})
+	return res, err
+}
+
+// runScript executes the script steps one by one and stops on the first failed step.
+func (s *Session) runScript(url string, sc *script, out io.Writer) []error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ws, err := s.dial(ctx, url)
+	if err != nil {
+		return []error{err}
+	}
+	defer s.closeConn(ws)
+	s.setConn(ws)
+	s.cancel = cancel
+	s.errors = []error{}
+	go func() {
+		sig := make(chan os.Signal, 2)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		fmt.Fprintf(os.Stderr, "\n%s signal received, exiting...\n", <-sig)
+		s.cancel()
+	}()
+	if err = s.setup(ctx, ws); err != nil {
+		return []error{err}
+	}
+	messages := make(chan string)
+	received := queue(ctx, messages)
+	go func() {
+		defer close(messages)
+		for {
+			msgType, data, err := ws.ReadMessage()
+			if err != nil {
+				var closeErr *websocket.CloseError
+				if errors.As(err, &closeErr) {
+					s.rec.recordClose(dirReceived, closeErr.Code, closeErr.Text)
+				}
+				if ctx.Err() == nil && !isNormalClose(err) {
+					s.setErr(fmt.Errorf("reading error: `%w`", err))
+				}
+				return
+			}
+			s.rec.record(messageEvent(dirReceived, msgType, data))
+			text := string(data)
+			if msgType == websocket.BinaryMessage && !options.binAsText {
+				text = "\n" + hex.Dump(data)
+			}
+			fmt.Fprint(out, formatMessage(s.getPrefix()+"< ", text, rxSprintf))
+			select {
+			case messages <- string(data):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	vars := map[string]string{}
+	for name, value := range sc.Vars {
+		vars[name] = value
+	}
+	last := ""
+	for i, st := range sc.Steps {
+		if err := s.runStep(ctx, &st, vars, &last, received, out); err != nil {
+			s.setErr(fmt.Errorf("step %d (%s, line %d): %w", i+1, st.action, st.line, err))
+			return s.getErr()
+		}
+	}
+	return s.getErr()
+}
+
+// queue passes the messages from in to the returned channel. The messages are buffered until they are taken,
+// so the sender is not blocked (and the connection is read) while the script is sleeping or sending.
+func queue(ctx context.Context, in <-chan string) <-chan string {
+	out := make(chan string)
+	go func() {
+		defer close(out)
+		pending := []string{}
+		for in != nil || len(pending) > 0 {
+			var send chan<- string
+			var next string
+			if len(pending) > 0 {
+				send, next = out, pending[0]
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-in:
+				if !ok {
+					in = nil
+					continue
+				}
+				pending = append(pending, msg)
+			case send <- next:
+				pending = pending[1:]
+			}
+		}
+	}()
+	return out
+}
+
+// runStep executes the single step. last is the message matched by the last expect step.
+func (s *Session) runStep(ctx context.Context, st *step, vars map[string]string, last *string, received <-chan string, out io.Writer) error {
+	switch st.action {
+	case "send":
+		text, err := expand(st.Send, vars)
+		if err != nil {
+			return err
+		}
+		if err = s.write(websocket.TextMessage, []byte(text)); err != nil {
+			return err
+		}
+		fmt.Fprint(out, formatMessage(s.getPrefix()+"> ", text, txSprintf))
+	case "expect":
+		expr, err := expand(st.Expect, vars)
+		if err != nil {
+			return err
+		}
+		m, err := compileMatcher(expr)
+		if err != nil {
+			return err
+		}
+		timeout := time.After(st.Timeout)
+		for {
+			select {
+			case <-ctx.Done():
+				return errors.New("interrupted")
+			case <-timeout:
+				return fmt.Errorf("%w: no message matching '%s' received in %s", errTimeout, expr, st.Timeout)
+			case text, ok := <-received:
+				if !ok {
+					return fmt.Errorf("connection closed while expecting message matching '%s'", expr)
+				}
+				if m.match(text) {
+					*last = text
+					return nil
+				}
+			}
+		}
+	case "capture":
+		v, ok := decodeJSON(*last)
+		if !ok {
+			return errors.New("the last expected message is not a JSON")
+		}
+		for name, q := range st.queries {
+			vars[name] = formatValue(q.eval(v))
+		}
+	case "sleep":
+		select {
+		case <-ctx.Done():
+			return errors.New("interrupted")
+		case <-time.After(st.Sleep):
+		}
+	case "ping":
+		payload, err := expand(st.Ping, vars)
+		if err != nil {
+			return err
+		}
+		return s.sendPing(payload, out)
+	case "close":
+		arg, err := expand(st.Close, vars)
+		if err != nil {
+			return err
+		}
+		return s.sendClose(arg, out)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadScript(t *testing.T) {
+	sc, err := loadScript(strings.NewReader(`
+timeout: 2s
+steps:
+  - send: hello
+  - expect: hel+o
+    timeout: 1s
+  - expect: '.ok'
+  - capture:
+      id: .session.id
+  - sleep: 10ms
+  - ping:
+  - close: 1001 bye
+`))
+	require.NoError(t, err)
+	require.Len(t, sc.Steps, 7)
+	actions := []string{}
+	for _, st := range sc.Steps {
+		actions = append(actions, st.action)
+	}
+	require.Equal(t, []string{"send", "expect", "expect", "capture", "sleep", "ping", "close"}, actions)
+	require.Equal(t, time.Second, sc.Steps[1].Timeout)
+	require.Equal(t, 2*time.Second, sc.Steps[2].Timeout)
+	require.Equal(t, ".session.id", sc.Steps[3].queries["id"].src)
+	require.Equal(t, 10*time.Millisecond, sc.Steps[4].Sleep)
+	require.Equal(t, "1001 bye", sc.Steps[6].Close)
+	testCases := map[string]string{
+		"":                                     "script has no steps",
+		"steps:\n  - send: a\n    ping: b":     "script parsing error: line 2: step has several actions: send and ping",
+		"steps:\n  - wait: 1s":                 "script parsing error: line 2: unknown step field 'wait'",
+		"steps:\n  - timeout: 1s":              "script parsing error: line 2: step has no action (send, expect, capture, sleep, ping or close)",
+		"steps:\n  - send: a\n    timeout: 1s": "script parsing error: line 2: timeout is allowed for expect step only",
+		"steps:\n  - send":                     "script parsing error: line 2: step must be a mapping",
+		"steps:\n  - capture: {a: .b ==}":      "script parsing error: line 2: query '.b ==': unexpected 'end of query'",
+		"step: []":                             "script parsing error: yaml: unmarshal errors:\n  line 1: field step not found in type main.script",
+	}
+	for src, expected := range testCases {
+		_, err := loadScript(strings.NewReader(src))
+		require.EqualError(t, err, expected, src)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	t.Setenv("WS_TEST_TOKEN", "secret")
+	res, err := expand(`{"$type": "${user}", "token": "${WS_TEST_TOKEN}"}`, map[string]string{"user": "guest"})
+	require.NoError(t, err)
+	require.Equal(t, `{"$type": "guest", "token": "secret"}`, res)
+	_, err = expand("${unknown_variable}", nil)
+	require.EqualError(t, err, "undefined variable 'unknown_variable'")
+}
+
+func TestQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := make(chan string)
+	out := queue(ctx, in)
+	for i := range 100 {
+		in <- strconv.Itoa(i)
+	}
+	close(in)
+	for i := range 100 {
+		require.Equal(t, strconv.Itoa(i), <-out)
+	}
+	_, ok := <-out
+	require.False(t, ok)
+}
+
+func TestRunScript(t *testing.T) {
+	newEchoServer(t)
+	sc, err := loadScript(strings.NewReader(`
+vars:
+  user: guest
+steps:
+  - send: '{"op": "login", "session": {"id": "${user}-1"}}'
+  - expect: '.op == "login"'
+  - capture:
+      id: .session.id
+  - send: hello ${id}
+  - expect: ^hello guest-1$
+  - ping: check
+  - sleep: 10ms
+  - close:
+`))
+	require.NoError(t, err)
+	out := &bytes.Buffer{}
+	errs := (&Session{}).runScript(mockURL, sc, out)
+	require.Empty(t, errs)
+	require.Contains(t, out.String(), "> hello guest-1\n< hello guest-1\n")
+	require.Contains(t, out.String(), " > ping: check\n")
+	require.Contains(t, out.String(), " > close: 1000 \n")
+}
+
+func TestRunScriptTimeout(t *testing.T) {
+	newEchoServer(t)
+	sc, err := loadScript(strings.NewReader(`
+steps:
+  - send: hello
+  - expect: bye
+    timeout: 20ms
+  - send: unreachable
+`))
+	require.NoError(t, err)
+	errs := (&Session{}).runScript(mockURL, sc, &bytes.Buffer{})
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs[0], "step 2 (expect, line 4): timeout: no message matching 'bye' received in 20ms")
+	require.True(t, errors.Is(errs[0], errTimeout))
+	require.Equal(t, exitTimeout, exitCode(errs))
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsFlags are raw TLS options
+var tlsFlags struct {
+	cert       string
+	key        string
+	caCert     string
+	minVersion string
+	serverName string
+}
+
+// loadTLSConfig makes the TLS configuration from options.insecure and tlsFlags
+func loadTLSConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: options.insecure,
+		ServerName:         tlsFlags.serverName,
+	}
+	if tlsFlags.minVersion != "" {
+		version, ok := tlsVersions[tlsFlags.minVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS version '%s', use one of 1.0, 1.1, 1.2, 1.3", tlsFlags.minVersion)
+		}
+		config.MinVersion = version
+	}
+	if tlsFlags.key != "" && tlsFlags.cert == "" {
+		return nil, errors.New("--key requires --cert")
+	}
+	if tlsFlags.cert != "" {
+		key := tlsFlags.key
+		if key == "" { // the key can be stored in the same PEM file
+			key = tlsFlags.cert
+		}
+		cert, err := tls.LoadX509KeyPair(tlsFlags.cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate error: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if tlsFlags.caCert != "" {
+		pool, err := loadCertPool(tlsFlags.caCert)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+// loadCertPool reads CA certificates from PEM file or from all files in directory
+func loadCertPool(path string) (*x509.CertPool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading CA certificates error: %w", err)
+	}
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("loading CA certificates error: %w", err)
+		}
+		files = files[:0]
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+	pool := x509.NewCertPool()
+	found := false
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("loading CA certificates error: %w", err)
+		}
+		if pool.AppendCertsFromPEM(data) {
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no PEM certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// explainTLSError replaces the certificate verification errors with readable descriptions and hints
+func explainTLSError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var (
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+	switch {
+	case errors.As(err, &authorityErr):
+		issuer := "unknown"
+		if authorityErr.Cert != nil {
+			issuer = authorityErr.Cert.Issuer.String()
+		}
+		return fmt.Errorf("TLS error: server certificate is signed by unknown authority '%s' (use --cacert to trust it or --insecure to skip verification)", issuer)
+	case errors.As(err, &hostnameErr):
+		names := append([]string{}, hostnameErr.Certificate.DNSNames...)
+		for _, ip := range hostnameErr.Certificate.IPAddresses {
+			names = append(names, ip.String())
+		}
+		if len(names) == 0 {
+			names = []string{hostnameErr.Certificate.Subject.CommonName}
+		}
+		return fmt.Errorf("TLS error: server certificate is valid for %s, not for %s (use --servername to set the expected name)", strings.Join(names, ", "), hostnameErr.Host)
+	case errors.As(err, &invalidErr):
+		if invalidErr.Reason == x509.Expired {
+			return fmt.Errorf("TLS error: server certificate is expired or not yet valid (valid from %s till %s)",
+				invalidErr.Cert.NotBefore.Format(time.RFC3339), invalidErr.Cert.NotAfter.Format(time.RFC3339))
+		}
+		return fmt.Errorf("TLS error: server certificate is invalid: %s", invalidErr.Error())
+	case strings.Contains(err.Error(), "remote error: tls: certificate required"),
+		strings.Contains(err.Error(), "remote error: tls: bad certificate"),
+		strings.Contains(err.Error(), "remote error: tls: unknown certificate authority"):
+		return fmt.Errorf("TLS error: server rejected the client certificate (use --cert and --key to provide the valid one): %w", err)
+	}
+	return err
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// newTestCert makes the certificate signed by parent (self-signed when parent is nil)
+func newTestCert(t *testing.T, name string, parent *testCert, notAfter time.Time) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		template.DNSNames = []string{name}
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (c *testCert) tlsCert(t *testing.T) tls.Certificate {
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+	cert, err := tls.X509KeyPair(c.pem, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	require.NoError(t, err)
+	return cert
+}
+
+func (c *testCert) write(t *testing.T, dir, name string, withKey bool) string {
+	data := c.pem
+	if withKey {
+		keyDER, err := x509.MarshalECPrivateKey(c.key)
+		require.NoError(t, err)
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})...)
+	}
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func newTLSServer(t *testing.T, ca, cert *testCert) string {
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, err := upgrader.Upgrade(w, r, nil); err == nil {
+			conn.Close()
+		}
+	}))
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{cert.tlsCert(t)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return "wss://" + strings.TrimPrefix(srv.URL, "https://")
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "Test CA", nil, time.Now().Add(time.Hour))
+	url := newTLSServer(t, ca, newTestCert(t, "localhost", ca, time.Now().Add(time.Hour)))
+	caPath := ca.write(t, dir, "ca.pem", false)
+	clientPath := newTestCert(t, "client", ca, time.Now().Add(time.Hour)).write(t, dir, "client.pem", true)
+	defer func() {
+		tlsFlags.cert = ""
+		tlsFlags.caCert = ""
+		tlsFlags.serverName = ""
+		options.tlsConfig = nil
+	}()
+	dial := func() error {
+		var err error
+		options.tlsConfig, err = loadTLSConfig()
+		require.NoError(t, err)
+		conn, err := (&Session{}).dial(context.Background(), url)
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+	require.EqualError(t, dial(), "TLS error: server certificate is signed by unknown authority 'CN=Test CA' (use --cacert to trust it or --insecure to skip verification)")
+	tlsFlags.caCert = caPath
+	tlsFlags.serverName = "example.com"
+	require.EqualError(t, dial(), "TLS error: server certificate is valid for localhost, 127.0.0.1, not for example.com (use --servername to set the expected name)")
+	tlsFlags.serverName = "localhost"
+	require.ErrorContains(t, dial(), "TLS error: server rejected the client certificate (use --cert and --key to provide the valid one)")
+	tlsFlags.cert = clientPath
+	require.NoError(t, dial())
+	// CA directory
+	tlsFlags.caCert = dir
+	require.NoError(t, dial())
+}
+
+func TestTLSExpired(t *testing.T) {
+	ca := newTestCert(t, "Test CA", nil, time.Now().Add(time.Hour))
+	url := newTLSServer(t, ca, newTestCert(t, "localhost", ca, time.Now().Add(-time.Minute)))
+	tlsFlags.caCert = ca.write(t, t.TempDir(), "ca.pem", false)
+	defer func() {
+		tlsFlags.caCert = ""
+		options.tlsConfig = nil
+	}()
+	var err error
+	options.tlsConfig, err = loadTLSConfig()
+	require.NoError(t, err)
+	_, err = (&Session{}).dial(context.Background(), url)
+	require.ErrorContains(t, err, "TLS error: server certificate is expired or not yet valid (valid from ")
+}
+
+func TestLoadTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	defer func() { tlsFlags = struct{ cert, key, caCert, minVersion, serverName string }{} }()
+	tlsFlags.minVersion = "1.3"
+	tlsFlags.serverName = "example.com"
+	config, err := loadTLSConfig()
+	require.NoError(t, err)
+	require.Equal(t, uint16(tls.VersionTLS13), config.MinVersion)
+	require.Equal(t, "example.com", config.ServerName)
+	tlsFlags.minVersion = "1.4"
+	_, err = loadTLSConfig()
+	require.EqualError(t, err, "unsupported TLS version '1.4', use one of 1.0, 1.1, 1.2, 1.3")
+	tlsFlags.minVersion = ""
+	tlsFlags.key = "key.pem"
+	_, err = loadTLSConfig()
+	require.EqualError(t, err, "--key requires --cert")
+	tlsFlags.key = ""
+	tlsFlags.cert = filepath.Join(dir, "missing.pem")
+	_, err = loadTLSConfig()
+	require.ErrorContains(t, err, "loading client certificate error: open ")
+	tlsFlags.cert = ""
+	tlsFlags.caCert = dir
+	_, err = loadTLSConfig()
+	require.EqualError(t, err, "no PEM certificates found in "+dir)
+}
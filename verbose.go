@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// handshakeInfo describes the handshake request and response, negotiated parameters of connection and TLS details.
+// ws is nil when the handshake is failed.
+func handshakeInfo(ws *websocket.Conn, resp *http.Response) string {
+	b := &strings.Builder{}
+	if req := resp.Request; req != nil {
+		fmt.Fprintf(b, "> %s %s HTTP/1.1\n", req.Method, req.URL.RequestURI())
+		fmt.Fprintf(b, "> Host: %s\n", req.URL.Host)
+		writeHeaders(b, "> ", req.Header)
+	}
+	fmt.Fprintf(b, "< %s %s\n", resp.Proto, resp.Status)
+	writeHeaders(b, "< ", resp.Header)
+	if ws == nil {
+		return b.String()
+	}
+	fmt.Fprintf(b, "remote address: %s (local %s)\n", ws.RemoteAddr(), ws.LocalAddr())
+	fmt.Fprintf(b, "subprotocol: %s\n", valueOrNone(ws.Subprotocol()))
+	fmt.Fprintf(b, "extensions: %s\n", valueOrNone(strings.Join(resp.Header.Values("Sec-Websocket-Extensions"), ", ")))
+	if conn, ok := ws.NetConn().(*tls.Conn); ok {
+		writeTLSState(b, conn.ConnectionState())
+	}
+	return b.String()
+}
+
+// writeHeaders writes the headers sorted by name, one line per value
+func writeHeaders(b *strings.Builder, prefix string, headers http.Header) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		for _, value := range headers[name] {
+			fmt.Fprintf(b, "%s%s: %s\n", prefix, name, value)
+		}
+	}
+}
+
+// writeTLSState writes the TLS version, cipher suite and the peer certificate chain
+func writeTLSState(b *strings.Builder, state tls.ConnectionState) {
+	fmt.Fprintf(b, "TLS version: %s, cipher suite: %s", tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite))
+	if state.NegotiatedProtocol != "" {
+		fmt.Fprintf(b, ", ALPN: %s", state.NegotiatedProtocol)
+	}
+	if state.ServerName != "" {
+		fmt.Fprintf(b, ", server name: %s", state.ServerName)
+	}
+	b.WriteString("\ncertificate chain:\n")
+	for i, cert := range state.PeerCertificates {
+		fmt.Fprintf(b, " %d subject: %s\n   issuer: %s\n   valid: %s - %s", i, cert.Subject, cert.Issuer,
+			cert.NotBefore.UTC().Format(time.DateOnly), cert.NotAfter.UTC().Format(time.DateOnly))
+		if left := time.Until(cert.NotAfter); left > 0 {
+			fmt.Fprintf(b, " (expires in %d days)\n", int(left.Hours()/24))
+		} else {
+			b.WriteString(" (expired)\n")
+		}
+	}
+}
+
+func valueOrNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandshakeInfo(t *testing.T) {
+	newEchoServer(t)
+	dialer := websocket.Dialer{EnableCompression: true}
+	ws, resp, err := dialer.DialContext(context.Background(), mockURL, http.Header{"Origin": {"http://localhost:8080"}})
+	require.NoError(t, err)
+	defer ws.Close()
+	info := handshakeInfo(ws, resp)
+	require.Contains(t, info, "> GET /ws HTTP/1.1\n> Host: localhost:8080\n")
+	require.Contains(t, info, "> Origin: http://localhost:8080\n")
+	require.Contains(t, info, "< HTTP/1.1 101 Switching Protocols\n< Connection: Upgrade\n")
+	require.Contains(t, info, "remote address: 127.0.0.1:8080 (local 127.0.0.1:")
+	require.Contains(t, info, "subprotocol: none\n")
+	require.Contains(t, info, "extensions: none\n")
+	require.NotContains(t, info, "TLS version")
+	// failed handshake
+	resp.StatusCode, resp.Status = 401, "401 Unauthorized"
+	require.Contains(t, handshakeInfo(nil, resp), "< HTTP/1.1 401 Unauthorized\n")
+	require.NotContains(t, handshakeInfo(nil, resp), "remote address")
+}
+
+func TestHandshakeInfoTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "Test CA", nil, time.Now().Add(time.Hour))
+	url := newTLSServer(t, ca, newTestCert(t, "localhost", ca, time.Now().Add(72*time.Hour)))
+	tlsFlags.caCert = ca.write(t, dir, "ca.pem", false)
+	tlsFlags.cert = newTestCert(t, "client", ca, time.Now().Add(time.Hour)).write(t, dir, "client.pem", true)
+	tlsFlags.serverName = "localhost"
+	defer func() {
+		tlsFlags.cert = ""
+		tlsFlags.caCert = ""
+		tlsFlags.serverName = ""
+		options.tlsConfig = nil
+	}()
+	var err error
+	options.tlsConfig, err = loadTLSConfig()
+	require.NoError(t, err)
+	dialer := websocket.Dialer{TLSClientConfig: options.tlsConfig}
+	ws, resp, err := dialer.DialContext(context.Background(), url, http.Header{"Origin": {"http://localhost"}})
+	require.NoError(t, err)
+	defer ws.Close()
+	info := handshakeInfo(ws, resp)
+	require.Contains(t, info, "TLS version: TLS 1.3, cipher suite: TLS_")
+	require.Contains(t, info, ", server name: localhost\ncertificate chain:\n 0 subject: CN=localhost\n   issuer: CN=Test CA\n   valid: ")
+	require.Contains(t, info, " (expires in 2 days)\n")
+}